@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"load-generator/helper"
+	"load-generator/lib"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+type SearchStrategy int
+
+const (
+	// SEARCH_STRATEGY_STEP raises the rate by StepPPS until a step misses the SLO.
+	SEARCH_STRATEGY_STEP SearchStrategy = 0
+	// SEARCH_STRATEGY_BINARY bisects between MinPPS and MaxPPS down to PrecisionPPS.
+	SEARCH_STRATEGY_BINARY SearchStrategy = 1
+)
+
+// CapacitySLO is what a step has to meet to count as sustainable.
+type CapacitySLO struct {
+	// P99LatencyNS isn't checked when 0.
+	P99LatencyNS time.Duration
+	// MaxErrorRatio is the highest accepted share of calls without
+	// RET_CODE_SUCCESS. It is always checked, 0 accepts no error at all.
+	MaxErrorRatio float64
+}
+
+// missedBy lists the reasons step doesn't meet the SLO, none when it does.
+func (receiver CapacitySLO) missedBy(step *CapacityStep) []string {
+	var reasons []string
+	if receiver.P99LatencyNS > 0 && step.P99LatencyNS > receiver.P99LatencyNS {
+		reasons = append(reasons, fmt.Sprintf("p99 %v > %v", step.P99LatencyNS, receiver.P99LatencyNS))
+	}
+	if step.ErrorRatio > receiver.MaxErrorRatio {
+		reasons = append(reasons, fmt.Sprintf("error ratio %.4f > %.4f", step.ErrorRatio, receiver.MaxErrorRatio))
+	}
+	return reasons
+}
+
+type CapacitySearchParams struct {
+	// Generator is the template of every step run. PPS and ResultChan are
+	// set per step, ResultSink, Stages, Shape, VirtualUsers and Trace can't be used.
+	Generator    NewLoadGeneratorParams
+	Strategy     SearchStrategy
+	MinPPS       uint64
+	MaxPPS       uint64
+	StepPPS      uint64
+	PrecisionPPS uint64
+	SLO          CapacitySLO
+	// CooldownNS is waited between two steps to let the target recover.
+	CooldownNS time.Duration
+}
+
+// CapacityStep holds the statistics of one step run, warm-up excluded.
+// Latency is the response time, measured from the intended send time.
+type CapacityStep struct {
+	PPS          uint64
+	Calls        uint64
+	Errors       uint64
+	ErrorRatio   float64
+	AchievedPPS  float64
+	P99LatencyNS time.Duration
+	Passed       bool
+	Reason       string
+}
+
+type CapacitySearchResult struct {
+	// MaxPPS is the highest rate that met the SLO, 0 if none did.
+	MaxPPS uint64
+	Steps  []CapacityStep
+}
+
+func (receiver *CapacitySearchParams) Check() error {
+	helper.Logger.Info("Start Checking CapacitySearchParams...")
+	var errMsgs []string
+	if receiver.MinPPS == 0 {
+		errMsgs = append(errMsgs, "Invalid minPPS!")
+	}
+
+	if receiver.MaxPPS < receiver.MinPPS {
+		errMsgs = append(errMsgs, "Invalid maxPPS!")
+	}
+
+	switch receiver.Strategy {
+	case SEARCH_STRATEGY_STEP:
+		if receiver.StepPPS == 0 {
+			errMsgs = append(errMsgs, "Invalid stepPPS!")
+		}
+	case SEARCH_STRATEGY_BINARY:
+		if receiver.PrecisionPPS == 0 {
+			errMsgs = append(errMsgs, "Invalid precisionPPS!")
+		}
+	default:
+		errMsgs = append(errMsgs, "Invalid strategy!")
+	}
+
+	if receiver.SLO.P99LatencyNS < 0 || receiver.SLO.MaxErrorRatio < 0 || receiver.SLO.MaxErrorRatio > 1 {
+		errMsgs = append(errMsgs, "Invalid SLO!")
+	}
+
+	if len(receiver.Generator.Stages) > 0 || receiver.Generator.Shape != nil || receiver.Generator.VirtualUsers > 0 || receiver.Generator.Trace != nil {
+		errMsgs = append(errMsgs, "Invalid generator, stages, shape, virtualUsers and trace can't be searched!")
+	}
+
+	generator := receiver.Generator
+	generator.PPS = receiver.MinPPS
+	generator.ResultChan = make(chan *lib.CallResult)
+	if err := generator.Check(); err != nil {
+		errMsgs = append(errMsgs, err.Error())
+	}
+
+	if len(errMsgs) > 0 {
+		errMsg := strings.Join(errMsgs, " ")
+		helper.Logger.Info("Didn't Pass Params Check", zap.String("err", errMsg))
+		return errors.New(errMsg)
+	}
+	return nil
+}
+
+// SearchCapacity drives a sequence of generator runs and returns the highest rate that met the SLO.
+func SearchCapacity(params CapacitySearchParams) (*CapacitySearchResult, error) {
+	if err := params.Check(); err != nil {
+		return nil, err
+	}
+
+	result := &CapacitySearchResult{}
+	try := func(pps uint64) (bool, error) {
+		if len(result.Steps) > 0 && params.CooldownNS > 0 {
+			time.Sleep(params.CooldownNS)
+		}
+		step, err := runCapacityStep(params, pps)
+		if err != nil {
+			return false, err
+		}
+		result.Steps = append(result.Steps, *step)
+		if step.Passed && step.PPS > result.MaxPPS {
+			result.MaxPPS = step.PPS
+		}
+		return step.Passed, nil
+	}
+
+	switch params.Strategy {
+	case SEARCH_STRATEGY_STEP:
+		for pps := params.MinPPS; pps <= params.MaxPPS; pps += params.StepPPS {
+			passed, err := try(pps)
+			if err != nil {
+				return nil, err
+			}
+			if !passed || params.MaxPPS-pps < params.StepPPS {
+				break
+			}
+		}
+	case SEARCH_STRATEGY_BINARY:
+		low, high := params.MinPPS, params.MaxPPS
+		for low <= high {
+			mid := low + (high-low)/2
+			passed, err := try(mid)
+			if err != nil {
+				return nil, err
+			}
+			if passed {
+				low = mid + params.PrecisionPPS
+			} else {
+				if mid < params.MinPPS+params.PrecisionPPS {
+					break
+				}
+				high = mid - params.PrecisionPPS
+			}
+		}
+	}
+	helper.Logger.Info("Capacity search finished", zap.Uint64("maxPPS", result.MaxPPS), zap.Int("steps", len(result.Steps)))
+	return result, nil
+}
+
+func runCapacityStep(params CapacitySearchParams, pps uint64) (*CapacityStep, error) {
+	generator := params.Generator
+	generator.PPS = pps
+	// Enough room for a second of results, the loop below drains it right away.
+	generator.ResultChan = make(chan *lib.CallResult, pps+1)
+	gen, err := NewLoadGenerator(generator)
+	if err != nil {
+		return nil, err
+	}
+
+	helper.Logger.Info("Capacity search step", zap.Uint64("pps", pps))
+	gen.Start()
+	step := &CapacityStep{PPS: pps}
+	var latencies []time.Duration
+	for r := range generator.ResultChan {
+		if r.IsEvent() || r.WarmUp {
+			continue
+		}
+		step.Calls++
+		if r.Code != lib.RET_CODE_SUCCESS {
+			step.Errors++
+		}
+		latencies = append(latencies, r.ResponseTime)
+	}
+	// The active duration of the run, so the drain after it doesn't dilute the rate.
+	elapsed := gen.Report().Metadata.DurationNS - generator.WarmUpDurationNS
+
+	if step.Calls == 0 {
+		step.Reason = "no results"
+		return step, nil
+	}
+	step.ErrorRatio = float64(step.Errors) / float64(step.Calls)
+	if elapsed > 0 {
+		step.AchievedPPS = float64(step.Calls-step.Errors) / elapsed.Seconds()
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	step.P99LatencyNS = percentileOf(latencies, 99)
+
+	reasons := params.SLO.missedBy(step)
+	step.Passed = len(reasons) == 0
+	step.Reason = strings.Join(reasons, ", ")
+	helper.Logger.Info("Capacity search step done", zap.Uint64("pps", pps), zap.Bool("passed", step.Passed), zap.Duration("p99", step.P99LatencyNS), zap.Float64("errorRatio", step.ErrorRatio), zap.String("reason", step.Reason))
+	return step, nil
+}
+
+// percentileOf returns the p-th percentile of ascending sorted values.
+func percentileOf(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index]
+}
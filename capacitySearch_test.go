@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// saturatingCaller serves up to capacity calls at a time and rejects the rest.
+type saturatingCaller struct {
+	sleepCaller
+	capacity int64
+	inFlight int64
+}
+
+func (receiver *saturatingCaller) Call(req []byte, timeoutNS time.Duration) ([]byte, error) {
+	defer atomic.AddInt64(&receiver.inFlight, -1)
+	if atomic.AddInt64(&receiver.inFlight, 1) > receiver.capacity {
+		return nil, errSaturated
+	}
+	return receiver.sleepCaller.Call(req, timeoutNS)
+}
+
+var errSaturated = &saturatedError{}
+
+type saturatedError struct{}
+
+func (receiver *saturatedError) Error() string {
+	return "saturated"
+}
+
+func TestSearchCapacity(t *testing.T) {
+	params := CapacitySearchParams{
+		Generator: NewLoadGeneratorParams{
+			// 5 calls of 10ms at a time sustain about 500 pps.
+			Caller:               &saturatingCaller{sleepCaller: sleepCaller{delay: 10 * time.Millisecond}, capacity: 5},
+			TimeoutNS:            100 * time.Millisecond,
+			ProcessingDurationNS: 300 * time.Millisecond,
+			StopGracePeriodNS:    time.Second,
+		},
+		Strategy:     SEARCH_STRATEGY_BINARY,
+		MinPPS:       100,
+		MaxPPS:       2000,
+		PrecisionPPS: 100,
+		SLO:          CapacitySLO{MaxErrorRatio: 0.01},
+	}
+	result, err := SearchCapacity(params)
+	if err != nil {
+		t.Fatalf("Capacity search failing: %s\n", err)
+	}
+	for _, step := range result.Steps {
+		t.Logf("Step %+v\n", step)
+	}
+	// The caller can't serve more than 500 pps, how much less depends on the
+	// machine. The search may overshoot by less than one precision step.
+	limit := 500 + params.PrecisionPPS
+	if result.MaxPPS < params.MinPPS || result.MaxPPS >= limit {
+		t.Fatalf("Unexpected max pps %d, expected between %d and %d.\n", result.MaxPPS, params.MinPPS, limit-1)
+	}
+	for _, step := range result.Steps {
+		if step.Passed && step.PPS > result.MaxPPS {
+			t.Fatalf("Step at %d pps passed above the reported max %d pps.\n", step.PPS, result.MaxPPS)
+		}
+	}
+
+	params.Strategy = SEARCH_STRATEGY_STEP
+	params.StepPPS = 0
+	if _, err := SearchCapacity(params); err == nil {
+		t.Fatalf("Step strategy accepted without stepPPS.\n")
+	}
+	params.Generator.VirtualUsers = 1
+	if _, err := SearchCapacity(params); err == nil {
+		t.Fatalf("Virtual users accepted for a capacity search.\n")
+	}
+}
+
+func TestPercentileOf(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i))
+	}
+	if p := percentileOf(sorted, 99); p != 99 {
+		t.Fatalf("Unexpected p99 %v.\n", p)
+	}
+	if p := percentileOf(sorted, 50); p != 50 {
+		t.Fatalf("Unexpected p50 %v.\n", p)
+	}
+	if p := percentileOf(nil, 99); p != 0 {
+		t.Fatalf("Unexpected p99 %v of no values.\n", p)
+	}
+}
+
+func TestCapacitySLO(t *testing.T) {
+	step := &CapacityStep{Calls: 1000, Errors: 1, ErrorRatio: 0.001, P99LatencyNS: 20 * time.Millisecond}
+	// MaxErrorRatio 0 tolerates no error, P99LatencyNS 0 any latency.
+	if reasons := (CapacitySLO{}).missedBy(step); len(reasons) != 1 {
+		t.Fatalf("Unexpected reasons %v for one error under a zero error ratio.\n", reasons)
+	}
+	if reasons := (CapacitySLO{MaxErrorRatio: 0.01}).missedBy(step); len(reasons) != 0 {
+		t.Fatalf("Unexpected reasons %v within the SLO.\n", reasons)
+	}
+	if reasons := (CapacitySLO{P99LatencyNS: 10 * time.Millisecond, MaxErrorRatio: 0.01}).missedBy(step); len(reasons) != 1 {
+		t.Fatalf("Unexpected reasons %v for a slow p99.\n", reasons)
+	}
+	step.Errors, step.ErrorRatio = 0, 0
+	if reasons := (CapacitySLO{}).missedBy(step); len(reasons) != 0 {
+		t.Fatalf("Unexpected reasons %v without errors.\n", reasons)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"load-generator/helper"
 	"load-generator/lib"
 	"math"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -18,6 +19,7 @@ const (
 	STATUS_STARTED  uint32 = 2
 	STATUS_STOPPING uint32 = 3
 	STATUS_STOPPED  uint32 = 4
+	STATUS_PAUSED   uint32 = 5
 
 	CALL_STATUS_INIT    = 0
 	CALL_STATUS_DONE    = 1
@@ -29,47 +31,163 @@ type loadGenerator struct {
 
 	ctx           context.Context
 	ctxCancelFunc context.CancelFunc
+	// callsCtx bounds the calls in flight; it outlives ctx by the stop grace period.
+	callsCtx           context.Context
+	callsCtxCancelFunc context.CancelFunc
 
 	pps                  uint64 // payloads per second
 	processingDurationNS time.Duration
 	timeoutDurationNS    time.Duration
 
 	concurrency uint64
+	// maxInFlight fixes concurrency when set, instead of deriving it from rate and timeout.
+	maxInFlight uint64
 	callCount   uint64
 
-	resultChan chan *lib.CallResult
+	resultSink lib.ResultSink
+	delivery   DeliveryMode
+	// spill wraps the result sink under DELIVERY_SPILL.
+	spill *lib.SpillSink
+	// resultLock guards resultSink against puts racing its close.
+	resultLock   sync.RWMutex
+	resultClosed bool
+
+	totalRequests uint64
+	issuedCount   uint64
+
+	warmUpDurationNS time.Duration
+
+	// pendingCalls counts issued calls whose result hasn't been delivered yet.
+	pendingCalls      int64
+	stopGracePeriodNS time.Duration
+	abandonedCount    uint64
+	// graceOver is closed once the stop grace period has run out, results
+	// still waiting for the sink under DELIVERY_BLOCK are ignored then.
+	graceOver chan struct{}
 
 	ticketsImpl lib.GoroutinePoolTickets
 
-	callerImpl lib.Caller
+	backpressure BackpressurePolicy
+	backlogSize  uint64
+	// backlog holds the calls queued under BACKPRESSURE_QUEUE, they count in pendingCalls.
+	backlog      chan scheduledCall
+	backlogDone  chan struct{}
+	blockedCount uint64
+	queuedCount  uint64
+	droppedCount uint64
+
+	callerImpl lib.ContextCaller
+	// cancellable is false when callerImpl adapts a plain Caller, whose calls ignore their context.
+	cancellable bool
+	// cancelledCount counts calls cut short through their context, lateCount
+	// calls that completed after their timeout result had been delivered.
+	cancelledCount uint64
+	lateCount      uint64
+
+	arrival     lib.ArrivalDistribution
+	arrivalName string
+
+	profileLock sync.RWMutex
+	profile     *loadProfile
+	// profileChanged is closed and replaced whenever profile is replaced.
+	profileChanged chan struct{}
+
+	virtualUsers uint64
+	thinkTimeNS  time.Duration
+
+	trace       lib.TraceSource
+	replaySpeed float64
+
+	schedulerTickNS time.Duration
+	// schedulerBurst is read atomically, SetPPS derives it anew unless burstFixed.
+	schedulerBurst uint64
+	// burstFixed is set when SchedulerBurst was given in the params.
+	burstFixed bool
+	scheduler  schedulerRecorder
+
+	clock runClock
+
+	// aggregator summarizes the call results of the run, including those resultSink refused.
+	aggregator   *lib.Aggregator
+	ignoredCount uint64
+
+	windowNS   time.Duration
+	windowChan chan *lib.TimeWindow
+	windows    *lib.WindowRecorder
+	windowLock sync.Mutex
+	timeSeries []lib.TimeWindow
+	// windowOffset is the active offset the current window started at.
+	windowOffset time.Duration
+	// windowsClosed is set once the last window was handed out and windowChan
+	// closed. It is never cleared, a stopped generator can't be restarted.
+	windowsClosed bool
+
+	runLock   sync.Mutex
+	startedAt time.Time
+	endedAt   time.Time
+	// ranFor is the active duration of the last run, set once it stopped.
+	ranFor time.Duration
 }
 
 func (receiver *loadGenerator) init() error {
 	helper.Logger.Info("Initializing loadGenerator...")
-	interval := 1e9 / receiver.pps
-	if interval == 0 {
-		helper.Logger.Info("Set interval to default value 10")
-		interval = 10
-	}
-
-	total := uint64(int64(receiver.timeoutDurationNS)/int64(interval) + 1)
-	if total > math.MaxUint64 {
-		helper.Logger.Info("Set concurrency to MaxUint64")
-		total = math.MaxUint64
-	}
-
-	receiver.concurrency = total
+	receiver.concurrency = receiver.poolSize()
 	tickets, err := lib.NewGoroutinePoolTickets(receiver.concurrency)
 	if err != nil {
 		helper.Logger.Error("Create NewGoroutinePoolTickets", zap.String("err", err.Error()))
 		return err
 	}
 	receiver.ticketsImpl = tickets
-	helper.Logger.Info("loadGenerator inited")
+	helper.Logger.Info("loadGenerator inited", zap.Uint64("concurrency", receiver.concurrency))
 	return nil
 }
 
-func (receiver *loadGenerator) callOne(rawReq *lib.RawRequest) *lib.RawResponse {
+// poolSize derives the number of goroutine tickets from the current rate and timeout.
+func (receiver *loadGenerator) poolSize() uint64 {
+	if receiver.maxInFlight > 0 {
+		return receiver.maxInFlight
+	}
+	if receiver.virtualUsers > 0 {
+		return receiver.virtualUsers
+	}
+	if receiver.trace != nil {
+		return DEFAULT_REPLAY_CONCURRENCY
+	}
+	profile, _ := receiver.currentProfile()
+	// Payloads stay in flight for up to the timeout, and one batch of up to
+	// schedulerBurst, or a spike's burst, may be dispatched before the earliest of them return.
+	inFlight := math.Ceil(receiver.timeout().Seconds() * float64(profile.peakPPS()))
+	extra := float64(receiver.burst() + profile.peakBurst())
+	if inFlight+extra >= math.MaxUint64 {
+		helper.Logger.Info("Set concurrency to MaxUint64")
+		return math.MaxUint64
+	}
+	return uint64(inFlight + extra)
+}
+
+func (receiver *loadGenerator) burst() uint64 {
+	return atomic.LoadUint64(&receiver.schedulerBurst)
+}
+
+func (receiver *loadGenerator) timeout() time.Duration {
+	return time.Duration(atomic.LoadInt64((*int64)(&receiver.timeoutDurationNS)))
+}
+
+func (receiver *loadGenerator) currentProfile() (*loadProfile, <-chan struct{}) {
+	receiver.profileLock.RLock()
+	defer receiver.profileLock.RUnlock()
+	return receiver.profile, receiver.profileChanged
+}
+
+func (receiver *loadGenerator) setProfile(profile *loadProfile) {
+	receiver.profileLock.Lock()
+	defer receiver.profileLock.Unlock()
+	receiver.profile = profile
+	close(receiver.profileChanged)
+	receiver.profileChanged = make(chan struct{})
+}
+
+func (receiver *loadGenerator) callOne(ctx context.Context, rawReq *lib.RawRequest) *lib.RawResponse {
 	atomic.AddUint64(&receiver.callCount, 1)
 	if rawReq == nil {
 		helper.Logger.Warn("rawReq is nil")
@@ -78,9 +196,9 @@ func (receiver *loadGenerator) callOne(rawReq *lib.RawRequest) *lib.RawResponse
 	var rawResp *lib.RawResponse
 
 	startTime := time.Now().UnixNano()
-	resp, err := receiver.callerImpl.Call(rawReq.Req, receiver.timeoutDurationNS)
+	resp, err := receiver.callerImpl.CallContext(ctx, rawReq.Req)
 	endTime := time.Now().UnixNano()
-	duration := time.Duration(startTime - endTime)
+	duration := time.Duration(endTime - startTime)
 	if err != nil {
 		errMsg := fmt.Sprintf("Sync CallOne Error: %s.", err)
 		rawResp = &lib.RawResponse{
@@ -99,118 +217,265 @@ func (receiver *loadGenerator) callOne(rawReq *lib.RawRequest) *lib.RawResponse
 	return rawResp
 }
 
-func (receiver *loadGenerator) asyncCall() {
-	receiver.ticketsImpl.Take()
-	go func() {
-		defer func() {
-			receiver.ticketsImpl.PutBack()
-		}()
-		rawReq := receiver.callerImpl.BuildReq()
-		var callStatus uint32
-		timer := time.AfterFunc(receiver.timeoutDurationNS, func() {
-			if !atomic.CompareAndSwapUint32(&callStatus, CALL_STATUS_INIT, CALL_STATUS_TIMEOUT) {
-				return
-			}
-			result := &lib.CallResult{
-				ID:     rawReq.ID,
-				Req:    rawReq,
-				Code:   lib.RET_CODE_WARNING_TIMEOUT,
-				Msg:    fmt.Sprintf("Timeout! Expected < %v", receiver.timeoutDurationNS),
-				Elapse: receiver.timeoutDurationNS,
-			}
-			receiver.sendResult(result)
-		})
-		resp := receiver.callOne(&rawReq)
-		if !atomic.CompareAndSwapUint32(&callStatus, CALL_STATUS_INIT, CALL_STATUS_DONE) {
+// scheduledCall is what the scheduler knew about a payload when it decided to issue it.
+type scheduledCall struct {
+	stage       int
+	spike       int
+	warmUp      bool
+	scheduledAt time.Time
+	// rawReq is the payload to send, built by the caller when nil.
+	rawReq *lib.RawRequest
+}
+
+func (receiver scheduledCall) annotate(result *lib.CallResult, startedAt time.Time) {
+	result.Stage = receiver.stage
+	result.Spike = receiver.spike
+	result.WarmUp = receiver.warmUp
+	result.ScheduledAt = receiver.scheduledAt
+	result.StartedAt = startedAt
+	result.ResponseTime = time.Since(receiver.scheduledAt)
+}
+
+// claimRequest reserves one of totalRequests and returns false once all of them are taken.
+func (receiver *loadGenerator) claimRequest() bool {
+	issued := atomic.AddUint64(&receiver.issuedCount, 1)
+	return receiver.totalRequests == 0 || issued <= receiver.totalRequests
+}
+
+// allIssued reports whether all of totalRequests have been issued.
+func (receiver *loadGenerator) allIssued() bool {
+	return receiver.totalRequests > 0 && atomic.LoadUint64(&receiver.issuedCount) >= receiver.totalRequests
+}
+
+// finishRun waits for the results of every issued call and stops the run.
+func (receiver *loadGenerator) finishRun() {
+	receiver.finishWhenDelivered()
+	<-receiver.ctx.Done()
+	receiver.prepareToStop(receiver.ctx.Err())
+}
+
+// finishWhenDelivered ends the run once every issued call has delivered its result.
+func (receiver *loadGenerator) finishWhenDelivered() {
+	helper.Logger.Info("loadGenerator sent all requests", zap.Uint64("totalRequests", receiver.totalRequests))
+	for atomic.LoadInt64(&receiver.pendingCalls) > 0 {
+		select {
+		case <-receiver.ctx.Done():
 			return
+		case <-time.After(time.Millisecond):
 		}
-		timer.Stop()
-		var result *lib.CallResult
-		if resp.Err != nil {
-			result = &lib.CallResult{
-				ID:     resp.ID,
-				Req:    rawReq,
-				Code:   lib.RET_CODE_ERR_CALL,
-				Msg:    resp.Err.Error(),
-				Elapse: resp.Elapse,
-			}
-		} else {
-			result = receiver.callerImpl.CheckResp(rawReq, *resp)
-			result.Elapse = resp.Elapse
+	}
+	receiver.ctxCancelFunc()
+}
+
+// syncCall builds, issues and checks one payload and delivers its result.
+// It returns once the underlying call has returned. The caller counts the
+// call in pendingCalls beforehand, syncCall takes it out once the result is delivered.
+func (receiver *loadGenerator) syncCall(call scheduledCall) {
+	var rawReq lib.RawRequest
+	if call.rawReq != nil {
+		rawReq = *call.rawReq
+	} else {
+		rawReq = receiver.callerImpl.BuildReq()
+	}
+	var callStatus uint32
+	startedAt := time.Now()
+	timeoutNS := receiver.timeout()
+	ctx, cancel := context.WithTimeout(receiver.callsCtx, timeoutNS)
+	defer cancel()
+	onTimeout := func() {
+		if !atomic.CompareAndSwapUint32(&callStatus, CALL_STATUS_INIT, CALL_STATUS_TIMEOUT) {
+			return
 		}
+		result := &lib.CallResult{
+			ID:     rawReq.ID,
+			Req:    rawReq,
+			Code:   lib.RET_CODE_WARNING_TIMEOUT,
+			Msg:    fmt.Sprintf("Timeout! Expected < %v", timeoutNS),
+			Elapse: timeoutNS,
+		}
+		call.annotate(result, startedAt)
 		receiver.sendResult(result)
-	}()
+		atomic.AddInt64(&receiver.pendingCalls, -1)
+	}
+	timer := time.AfterFunc(timeoutNS, onTimeout)
+	receiver.windows.Sent()
+	resp := receiver.callOne(ctx, &rawReq)
+	timer.Stop()
+	if resp.Err != nil && ctx.Err() == context.DeadlineExceeded {
+		// The context deadline may beat the timer, report it as a timeout all the same.
+		onTimeout()
+	}
+	// A plain Caller can't be cancelled, an error past the deadline is its own.
+	cancelled := receiver.cancellable && resp.Err != nil && ctx.Err() != nil
+	if !atomic.CompareAndSwapUint32(&callStatus, CALL_STATUS_INIT, CALL_STATUS_DONE) {
+		if cancelled {
+			atomic.AddUint64(&receiver.cancelledCount, 1)
+		} else {
+			atomic.AddUint64(&receiver.lateCount, 1)
+		}
+		return
+	}
+	if cancelled {
+		atomic.AddUint64(&receiver.cancelledCount, 1)
+	}
+	var result *lib.CallResult
+	if resp.Err != nil {
+		result = &lib.CallResult{
+			ID:     resp.ID,
+			Req:    rawReq,
+			Code:   lib.RET_CODE_ERR_CALL,
+			Msg:    resp.Err.Error(),
+			Elapse: resp.Elapse,
+		}
+	} else {
+		result = receiver.callerImpl.CheckResp(rawReq, *resp)
+		result.Elapse = resp.Elapse
+	}
+	call.annotate(result, startedAt)
+	receiver.sendResult(result)
+	atomic.AddInt64(&receiver.pendingCalls, -1)
 }
 
 func (receiver *loadGenerator) sendResult(result *lib.CallResult) bool {
-	if receiver.Status() != STATUS_STARTED {
+	result.Arrival = receiver.arrivalName
+	receiver.resultLock.RLock()
+	defer receiver.resultLock.RUnlock()
+	if receiver.resultClosed {
 		receiver.printIgnoredResult(result, "load generator stopped")
 		return false
 	}
-
-	select {
-	case receiver.resultChan <- result:
+	receiver.aggregator.Add(result)
+	receiver.windows.Add(result)
+	if receiver.delivery == DELIVERY_BLOCK {
+		if !lib.PutWait(receiver.resultSink, result, receiver.graceOver) {
+			receiver.printIgnoredResult(result, "stop grace period is over")
+			return false
+		}
 		return true
-	default:
-		receiver.printIgnoredResult(result, "result channel is full")
+	}
+	if !receiver.resultSink.Put(result) {
+		receiver.printIgnoredResult(result, "result sink is full")
 		return false
 	}
 	return true
 }
 
+func (receiver *loadGenerator) sendEvent(event *lib.Event) bool {
+	event.Time = time.Now()
+	result := &lib.CallResult{
+		Code:        lib.RET_CODE_EVENT,
+		Msg:         lib.GetEventTypePlain(event.Type),
+		Event:       event,
+		ScheduledAt: event.Time,
+		StartedAt:   event.Time,
+	}
+	return receiver.sendResult(result)
+}
+
 func (receiver *loadGenerator) printIgnoredResult(result *lib.CallResult, cause string) {
+	if !result.IsEvent() {
+		atomic.AddUint64(&receiver.ignoredCount, 1)
+	}
 	helper.Logger.Info("Ignored result", zap.Int64("ID", result.ID), zap.Int("Code", int(result.Code)), zap.String("Msg", result.Msg), zap.Duration("Elapse", result.Elapse), zap.String("cause", cause))
 }
 
 func (receiver *loadGenerator) prepareToStop(err error) {
 	helper.Logger.Info("loadGenerator prepareToStop")
-	atomic.CompareAndSwapUint32(&receiver.status, STATUS_STARTED, STATUS_STOPPING)
-	close(receiver.resultChan)
+	if !atomic.CompareAndSwapUint32(&receiver.status, STATUS_STARTED, STATUS_STOPPING) {
+		atomic.CompareAndSwapUint32(&receiver.status, STATUS_PAUSED, STATUS_STOPPING)
+	}
+	ranFor := receiver.clock.elapsed()
+	if receiver.backlogDone != nil {
+		// Queued calls are dropped rather than abandoned.
+		<-receiver.backlogDone
+	}
+	receiver.drain()
+	close(receiver.graceOver)
+	receiver.callsCtxCancelFunc()
+	receiver.resultLock.Lock()
+	receiver.resultClosed = true
+	if err := receiver.resultSink.Close(); err != nil {
+		helper.Logger.Error("Close result sink", zap.String("err", err.Error()))
+	}
+	receiver.resultLock.Unlock()
+	receiver.runLock.Lock()
+	receiver.endedAt = time.Now()
+	receiver.ranFor = ranFor
+	receiver.runLock.Unlock()
+	receiver.closeWindow(time.Now(), true)
 	atomic.StoreUint32(&receiver.status, STATUS_STOPPED)
 }
 
-func (receiver *loadGenerator) genLoad(throttle <-chan time.Time) {
-	helper.Logger.Info("loadGenerator generating payloads...")
-	for {
-		select {
-		case <-receiver.ctx.Done():
-			receiver.prepareToStop(receiver.ctx.Err())
-			return
-		default:
-		}
-		receiver.asyncCall()
-		if receiver.pps > 0 {
-			select {
-			case <-throttle:
-			case <-receiver.ctx.Done():
-				receiver.prepareToStop(receiver.ctx.Err())
-				return
-			}
-		}
+// drain waits up to stopGracePeriodNS for the calls in flight to deliver
+// their results; whatever is still outstanding afterwards is abandoned.
+func (receiver *loadGenerator) drain() {
+	deadline := time.Now().Add(receiver.stopGracePeriodNS)
+	for atomic.LoadInt64(&receiver.pendingCalls) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
 	}
+	abandoned := atomic.LoadInt64(&receiver.pendingCalls)
+	if abandoned < 0 {
+		abandoned = 0
+	}
+	atomic.StoreUint64(&receiver.abandonedCount, uint64(abandoned))
+	helper.Logger.Info("loadGenerator drained", zap.Duration("gracePeriodNS", receiver.stopGracePeriodNS), zap.Int64("abandoned", abandoned))
 }
 
+// Start runs the generator once. Stopping closes the result sink, and with it
+// ResultChan and WindowChan, so a stopped generator can't be started again.
 func (receiver *loadGenerator) Start() bool {
 	helper.Logger.Info("loadGenerator Starting...")
 	if !atomic.CompareAndSwapUint32(&receiver.status, STATUS_INIT, STATUS_STARTING) {
-		if !atomic.CompareAndSwapUint32(&receiver.status, STATUS_STOPPED, STATUS_STARTING) {
-			return false
+		if atomic.LoadUint32(&receiver.status) == STATUS_STOPPED {
+			helper.Logger.Info("loadGenerator can't restart, its result sink is closed")
 		}
+		return false
 	}
 
-	var throttle <-chan time.Time
-	if receiver.pps > 0 {
-		interval := time.Duration(1e9 / receiver.pps)
-		throttle = time.Tick(interval)
-	}
-
-	receiver.ctx, receiver.ctxCancelFunc = context.WithTimeout(context.Background(), receiver.processingDurationNS)
+	receiver.ctx, receiver.ctxCancelFunc = context.WithCancel(context.Background())
+	receiver.callsCtx, receiver.callsCtxCancelFunc = context.WithCancel(context.Background())
+	receiver.graceOver = make(chan struct{})
 	receiver.callCount = 0
+	receiver.issuedCount = 0
+	receiver.abandonedCount = 0
+	receiver.cancelledCount = 0
+	receiver.lateCount = 0
+	receiver.blockedCount = 0
+	receiver.queuedCount = 0
+	receiver.droppedCount = 0
+	receiver.ignoredCount = 0
+	receiver.aggregator.Reset()
+	receiver.scheduler.reset()
+	receiver.ticketsImpl.ResetPeak()
+	receiver.clock.reset()
+	receiver.runLock.Lock()
+	receiver.startedAt = time.Now()
+	receiver.endedAt = time.Time{}
+	receiver.ranFor = 0
+	receiver.runLock.Unlock()
+	receiver.windowLock.Lock()
+	receiver.windows.Rotate(time.Now())
+	receiver.timeSeries = nil
+	receiver.windowOffset = 0
+	receiver.windowLock.Unlock()
 
 	atomic.StoreUint32(&receiver.status, STATUS_STARTED)
 
+	go receiver.watchDeadline()
+	go receiver.watchWindows(receiver.ctx)
+	if receiver.backpressure == BACKPRESSURE_QUEUE {
+		receiver.backlog = make(chan scheduledCall, receiver.backlogSize)
+		receiver.backlogDone = make(chan struct{})
+		go receiver.sendBacklog(receiver.ctx, receiver.backlog, receiver.backlogDone)
+	}
 	go func() {
-		receiver.genLoad(throttle)
+		if receiver.virtualUsers > 0 {
+			receiver.genClosedLoad()
+		} else if receiver.trace != nil {
+			receiver.genReplay()
+		} else {
+			receiver.genLoad()
+		}
 	}()
 
 	helper.Logger.Info("loadGenerator Started")
@@ -220,7 +485,9 @@ func (receiver *loadGenerator) Start() bool {
 func (receiver *loadGenerator) Stop() bool {
 	helper.Logger.Info("loadGenerator Stopping...")
 	if !atomic.CompareAndSwapUint32(&receiver.status, STATUS_STARTED, STATUS_STOPPING) {
-		return false
+		if !atomic.CompareAndSwapUint32(&receiver.status, STATUS_PAUSED, STATUS_STOPPING) {
+			return false
+		}
 	}
 	receiver.ctxCancelFunc()
 	for {
@@ -233,6 +500,82 @@ func (receiver *loadGenerator) Stop() bool {
 	return true
 }
 
+// Pause stops issuing payloads and suspends the processing-duration clock.
+// Calls already in flight complete and deliver their results as usual.
+func (receiver *loadGenerator) Pause() bool {
+	helper.Logger.Info("loadGenerator Pausing...")
+	if !atomic.CompareAndSwapUint32(&receiver.status, STATUS_STARTED, STATUS_PAUSED) {
+		return false
+	}
+	receiver.clock.pause()
+	helper.Logger.Info("loadGenerator Paused", zap.Duration("elapsed", receiver.clock.elapsed()))
+	return true
+}
+
+// Resume continues a paused run with its remaining duration and schedule.
+func (receiver *loadGenerator) Resume() bool {
+	helper.Logger.Info("loadGenerator Resuming...")
+	if !atomic.CompareAndSwapUint32(&receiver.status, STATUS_PAUSED, STATUS_STARTED) {
+		return false
+	}
+	receiver.clock.resume()
+	helper.Logger.Info("loadGenerator Resumed")
+	return true
+}
+
+// SetPPS switches a running generator to a constant rate of pps, replacing
+// any stage profile or shape for the rest of the run, and resizes the goroutine pool.
+// Spikes still to come are kept on top of the new rate.
+// It isn't available for virtual users and trace replay.
+func (receiver *loadGenerator) SetPPS(pps uint64) bool {
+	helper.Logger.Info("loadGenerator Setting pps...", zap.Uint64("pps", pps))
+	if pps == 0 || receiver.virtualUsers > 0 || receiver.trace != nil {
+		return false
+	}
+	if status := receiver.Status(); status != STATUS_STARTED && status != STATUS_PAUSED {
+		return false
+	}
+	atomic.StoreUint64(&receiver.pps, pps)
+	current, _ := receiver.currentProfile()
+	profile := &loadProfile{pps: pps, spikes: current.spikes}
+	receiver.setProfile(profile)
+	if !receiver.burstFixed {
+		// A burst derived from the old rate would stop the batching at a higher one.
+		atomic.StoreUint64(&receiver.schedulerBurst, defaultSchedulerBurst(profile.peakPPS(), receiver.schedulerTickNS))
+	}
+	receiver.resizePool()
+	receiver.sendEvent(&lib.Event{Type: lib.EVENT_RATE_CHANGED, PPS: pps, TimeoutNS: receiver.timeout()})
+	return true
+}
+
+// SetTimeout changes the timeout of calls issued from now on and resizes the goroutine pool.
+func (receiver *loadGenerator) SetTimeout(timeoutNS time.Duration) bool {
+	helper.Logger.Info("loadGenerator Setting timeout...", zap.Duration("timeoutNS", timeoutNS))
+	if timeoutNS <= 0 {
+		return false
+	}
+	if status := receiver.Status(); status != STATUS_STARTED && status != STATUS_PAUSED {
+		return false
+	}
+	atomic.StoreInt64((*int64)(&receiver.timeoutDurationNS), int64(timeoutNS))
+	receiver.resizePool()
+	receiver.sendEvent(&lib.Event{Type: lib.EVENT_TIMEOUT_CHANGED, PPS: atomic.LoadUint64(&receiver.pps), TimeoutNS: timeoutNS})
+	return true
+}
+
+func (receiver *loadGenerator) resizePool() {
+	if receiver.maxInFlight > 0 {
+		return
+	}
+	total := receiver.poolSize()
+	if err := receiver.ticketsImpl.Resize(total); err != nil {
+		helper.Logger.Error("Resize GoroutinePoolTickets", zap.String("err", err.Error()))
+		return
+	}
+	atomic.StoreUint64(&receiver.concurrency, total)
+	helper.Logger.Info("loadGenerator resized goroutine pool", zap.Uint64("concurrency", total))
+}
+
 func (receiver *loadGenerator) Status() uint32 {
 	return atomic.LoadUint32(&receiver.status)
 }
@@ -241,11 +584,51 @@ func (receiver *loadGenerator) CallCount() uint64 {
 	return atomic.LoadUint64(&receiver.callCount)
 }
 
+// AbandonedCount returns how many calls were still outstanding when the last run closed its result channel.
+func (receiver *loadGenerator) AbandonedCount() uint64 {
+	return atomic.LoadUint64(&receiver.abandonedCount)
+}
+
+// CancelledCount returns how many calls were cancelled through their context, on timeout or on stop.
+// Only a ContextCaller can be cancelled; calls of a plain Caller that return
+// after their timeout count in LateCount, even when they fail.
+func (receiver *loadGenerator) CancelledCount() uint64 {
+	return atomic.LoadUint64(&receiver.cancelledCount)
+}
+
+// LateCount returns how many calls completed after their timeout had already been reported.
+func (receiver *loadGenerator) LateCount() uint64 {
+	return atomic.LoadUint64(&receiver.lateCount)
+}
+
+// PeakInFlight returns the most calls in flight at once during the last run.
+func (receiver *loadGenerator) PeakInFlight() uint64 {
+	return receiver.ticketsImpl.PeakInUse()
+}
+
+func (receiver *loadGenerator) SchedulerStats() SchedulerStats {
+	return receiver.scheduler.snapshot()
+}
+
 type Generator interface {
+	// Start returns false unless the generator is new, a stopped generator can't be restarted.
 	Start() bool
 	Stop() bool
+	Pause() bool
+	Resume() bool
+	SetPPS(pps uint64) bool
+	SetTimeout(timeoutNS time.Duration) bool
 	Status() uint32
 	CallCount() uint64
+	AbandonedCount() uint64
+	CancelledCount() uint64
+	LateCount() uint64
+	PeakInFlight() uint64
+	SchedulerStats() SchedulerStats
+	BackpressureStats() BackpressureStats
+	TimeSeries() []lib.TimeWindow
+	// Report summarizes the last run, see Report.
+	Report() *Report
 }
 
 // NewLoadGenerator ...
@@ -258,13 +641,79 @@ func NewLoadGenerator(
 	}
 
 	gen := &loadGenerator{
-		callerImpl:           params.Caller,
+		callerImpl:           params.ContextCaller,
 		pps:                  params.PPS,
 		processingDurationNS: params.ProcessingDurationNS,
 		timeoutDurationNS:    params.TimeoutNS,
-		resultChan:           params.ResultChan,
+		resultSink:           params.ResultSink,
+		delivery:             params.Delivery,
+		arrival:              params.Arrival,
+		profile:              &loadProfile{pps: params.PPS, stages: append([]Stage(nil), params.Stages...), shape: params.Shape.clone(), spikes: append([]Spike(nil), params.Spikes...)},
+		profileChanged:       make(chan struct{}),
+		virtualUsers:         params.VirtualUsers,
+		thinkTimeNS:          params.ThinkTimeNS,
+		trace:                params.Trace,
+		replaySpeed:          params.ReplaySpeed,
+		schedulerTickNS:      params.SchedulerTickNS,
+		schedulerBurst:       params.SchedulerBurst,
+		stopGracePeriodNS:    params.StopGracePeriodNS,
+		totalRequests:        params.TotalRequests,
+		warmUpDurationNS:     params.WarmUpDurationNS,
+		maxInFlight:          params.MaxInFlight,
+		backpressure:         params.Backpressure,
+		backlogSize:          params.BackpressureQueueSize,
+		aggregator:           lib.NewAggregator(),
+		windowNS:             params.WindowNS,
+		windowChan:           params.WindowChan,
+		windows:              lib.NewWindowRecorder(time.Now()),
 		status:               STATUS_INIT,
 	}
+	if gen.resultSink == nil {
+		gen.resultSink = lib.NewChannelSink(params.ResultChan)
+	}
+	if gen.delivery == DELIVERY_SPILL {
+		spill, err := lib.NewSpillSink(gen.resultSink, params.SpillDir)
+		if err != nil {
+			helper.Logger.Error("Create SpillSink", zap.String("err", err.Error()))
+			return nil, err
+		}
+		gen.spill = spill
+		gen.resultSink = spill
+	}
+	gen.cancellable = gen.callerImpl != nil
+	if gen.callerImpl == nil {
+		_, gen.cancellable = params.Caller.(lib.ContextCaller)
+		gen.callerImpl = lib.NewContextCallerAdapter(params.Caller)
+	}
+	if gen.windowNS == 0 {
+		gen.windowNS = DEFAULT_WINDOW
+	}
+	if gen.schedulerTickNS == 0 {
+		gen.schedulerTickNS = DEFAULT_SCHEDULER_TICK
+	}
+	if gen.trace != nil && gen.replaySpeed == 0 {
+		gen.replaySpeed = 1
+	}
+	gen.burstFixed = gen.schedulerBurst > 0
+	if !gen.burstFixed && gen.trace != nil {
+		// The rate of a trace isn't known up front, a batch may fill the pool.
+		gen.schedulerBurst = gen.poolSize()
+	} else if !gen.burstFixed {
+		gen.schedulerBurst = defaultSchedulerBurst(gen.profile.peakPPS(), gen.schedulerTickNS)
+	}
+	if gen.processingDurationNS == 0 {
+		gen.processingDurationNS = gen.profile.duration()
+	}
+	if gen.arrival == nil {
+		gen.arrival = lib.NewConstantArrival()
+	}
+	gen.arrivalName = gen.arrival.Name()
+	if gen.virtualUsers > 0 {
+		gen.arrivalName = closedLoopArrivalName(gen.virtualUsers, gen.thinkTimeNS)
+	}
+	if gen.trace != nil {
+		gen.arrivalName = replayArrivalName(gen.replaySpeed)
+	}
 
 	if err := gen.init(); err != nil {
 		return nil, err
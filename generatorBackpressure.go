@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"load-generator/helper"
+	"sync/atomic"
+)
+
+type BackpressurePolicy int
+
+const (
+	// BACKPRESSURE_BLOCK holds the scheduler until a goroutine ticket is free or the run ends.
+	BACKPRESSURE_BLOCK BackpressurePolicy = 0
+	// BACKPRESSURE_DROP doesn't send payloads that find the pool exhausted.
+	BACKPRESSURE_DROP BackpressurePolicy = 1
+	// BACKPRESSURE_QUEUE spills payloads into a bounded queue that is sent in
+	// order as tickets are put back, and drops them once the queue is full.
+	BACKPRESSURE_QUEUE BackpressurePolicy = 2
+)
+
+// BackpressureStats counts the payloads that couldn't be issued on time because the goroutine pool was exhausted.
+type BackpressureStats struct {
+	// Blocked counts payloads the scheduler had to wait for a ticket for.
+	Blocked uint64
+	// Queued counts payloads spilled into the queue, Dropped those never sent.
+	Queued  uint64
+	Dropped uint64
+}
+
+// asyncCall issues the call on its own goroutine, following the backpressure
+// policy when the goroutine pool is exhausted.
+func (receiver *loadGenerator) asyncCall(call scheduledCall) {
+	switch receiver.backpressure {
+	case BACKPRESSURE_DROP:
+		if !receiver.ticketsImpl.TryTake() {
+			receiver.drop()
+			return
+		}
+	case BACKPRESSURE_QUEUE:
+		if len(receiver.backlog) > 0 || !receiver.ticketsImpl.TryTake() {
+			atomic.AddInt64(&receiver.pendingCalls, 1)
+			select {
+			case receiver.backlog <- call:
+				atomic.AddUint64(&receiver.queuedCount, 1)
+			default:
+				atomic.AddInt64(&receiver.pendingCalls, -1)
+				receiver.drop()
+			}
+			return
+		}
+	default:
+		if !receiver.ticketsImpl.TryTake() {
+			atomic.AddUint64(&receiver.blockedCount, 1)
+			// The tickets may be held by calls waiting for the sink until the run ends.
+			if !receiver.ticketsImpl.TakeUntil(receiver.ctx.Done()) {
+				atomic.AddUint64(&receiver.issuedCount, ^uint64(0))
+				return
+			}
+		}
+	}
+	atomic.AddInt64(&receiver.pendingCalls, 1)
+	receiver.launch(call)
+}
+
+// launch runs a call that holds a ticket and is counted in pendingCalls.
+func (receiver *loadGenerator) launch(call scheduledCall) {
+	go func() {
+		defer func() {
+			receiver.ticketsImpl.PutBack()
+		}()
+		receiver.syncCall(call)
+	}()
+}
+
+// drop counts a payload that wasn't sent. It doesn't count towards totalRequests.
+func (receiver *loadGenerator) drop() {
+	if atomic.AddUint64(&receiver.droppedCount, 1) == 1 {
+		helper.Logger.Warn("loadGenerator dropping payloads, goroutine pool exhausted", zap.Uint64("concurrency", receiver.ticketsImpl.Total()))
+	}
+	atomic.AddUint64(&receiver.issuedCount, ^uint64(0))
+}
+
+// sendBacklog issues the queued calls in order as tickets are put back, and
+// holds them while the run is paused. Calls still queued when the run ends
+// are dropped, done is closed afterwards.
+func (receiver *loadGenerator) sendBacklog(ctx context.Context, backlog <-chan scheduledCall, done chan<- struct{}) {
+	defer close(done)
+	for {
+		select {
+		case call := <-backlog:
+			if !receiver.takeWhenRunning(ctx) {
+				atomic.AddInt64(&receiver.pendingCalls, -1)
+				receiver.drop()
+				continue
+			}
+			receiver.launch(call)
+		case <-ctx.Done():
+			for {
+				select {
+				case <-backlog:
+					atomic.AddInt64(&receiver.pendingCalls, -1)
+					receiver.drop()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// takeWhenRunning waits for a ticket while the run isn't paused, and returns
+// false if ctx is done first.
+func (receiver *loadGenerator) takeWhenRunning(ctx context.Context) bool {
+	for receiver.waitWhilePaused(ctx) {
+		if !receiver.ticketsImpl.TakeUntil(ctx.Done()) {
+			return false
+		}
+		// The run may have been paused while waiting for the ticket.
+		if running, _ := receiver.clock.running(); running {
+			return true
+		}
+		receiver.ticketsImpl.PutBack()
+	}
+	return false
+}
+
+func (receiver *loadGenerator) BackpressureStats() BackpressureStats {
+	return BackpressureStats{
+		Blocked: atomic.LoadUint64(&receiver.blockedCount),
+		Queued:  atomic.LoadUint64(&receiver.queuedCount),
+		Dropped: atomic.LoadUint64(&receiver.droppedCount),
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pauseSpan is one pause, starting at active offset at and lasting length.
+type pauseSpan struct {
+	at     time.Duration
+	length time.Duration
+}
+
+// runClock measures the active time of a run. Time spent paused is left out,
+// so schedules and the processing duration are expressed as active offsets.
+type runClock struct {
+	lock     sync.Mutex
+	start    time.Time
+	pausedAt time.Time // zero while running
+	paused   time.Duration
+	pauses   []pauseSpan
+	// changed is closed and replaced on every pause and resume.
+	changed chan struct{}
+}
+
+func (receiver *runClock) reset() {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	receiver.start = time.Now()
+	receiver.pausedAt = time.Time{}
+	receiver.paused = 0
+	receiver.pauses = nil
+	receiver.changed = make(chan struct{})
+}
+
+func (receiver *runClock) notify() {
+	close(receiver.changed)
+	receiver.changed = make(chan struct{})
+}
+
+func (receiver *runClock) pause() {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	if !receiver.pausedAt.IsZero() {
+		return
+	}
+	receiver.pausedAt = time.Now()
+	receiver.pauses = append(receiver.pauses, pauseSpan{at: receiver.pausedAt.Sub(receiver.start) - receiver.paused})
+	receiver.notify()
+}
+
+func (receiver *runClock) resume() {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	if receiver.pausedAt.IsZero() {
+		return
+	}
+	length := time.Since(receiver.pausedAt)
+	receiver.paused += length
+	receiver.pauses[len(receiver.pauses)-1].length = length
+	receiver.pausedAt = time.Time{}
+	receiver.notify()
+}
+
+// elapsed returns the active time since the run started.
+func (receiver *runClock) elapsed() time.Duration {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	now := time.Now()
+	if !receiver.pausedAt.IsZero() {
+		now = receiver.pausedAt
+	}
+	return now.Sub(receiver.start) - receiver.paused
+}
+
+// wallTime converts an active offset into wall-clock time, shifted only by
+// the pauses that began before it. running is false while the clock is
+// paused; the returned channel is closed on the next pause or resume.
+func (receiver *runClock) wallTime(offset time.Duration) (wall time.Time, running bool, changed <-chan struct{}) {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	shift := receiver.paused
+	for i := len(receiver.pauses) - 1; i >= 0 && receiver.pauses[i].at >= offset; i-- {
+		shift -= receiver.pauses[i].length
+	}
+	return receiver.start.Add(shift + offset), receiver.pausedAt.IsZero(), receiver.changed
+}
+
+// running reports whether the clock isn't paused; the returned channel is
+// closed on the next pause or resume.
+func (receiver *runClock) running() (bool, <-chan struct{}) {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	return receiver.pausedAt.IsZero(), receiver.changed
+}
+
+// waitWhilePaused blocks until the run isn't paused. It returns false if ctx is done first.
+func (receiver *loadGenerator) waitWhilePaused(ctx context.Context) bool {
+	for {
+		running, changed := receiver.clock.running()
+		if running {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// waitForOffset blocks until the active offset is reached, sleeping through
+// pauses, or until interrupt is closed. It returns false if the run ended first.
+func (receiver *loadGenerator) waitForOffset(offset time.Duration, interrupt <-chan struct{}) bool {
+	for {
+		wall, running, changed := receiver.clock.wallTime(offset)
+		if !running {
+			select {
+			case <-changed:
+				continue
+			case <-interrupt:
+				return true
+			case <-receiver.ctx.Done():
+				return false
+			}
+		}
+		wait := time.Until(wall)
+		if wait <= 0 {
+			break
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+			continue
+		case <-interrupt:
+			timer.Stop()
+			return true
+		case <-receiver.ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+	select {
+	case <-receiver.ctx.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+// watchDeadline ends the run once processingDurationNS of active time has passed.
+func (receiver *loadGenerator) watchDeadline() {
+	if receiver.processingDurationNS == 0 {
+		return
+	}
+	if receiver.waitForOffset(receiver.processingDurationNS, nil) {
+		receiver.ctxCancelFunc()
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+type DeliveryMode int
+
+const (
+	// DELIVERY_BEST_EFFORT ignores results the sink has no room for, and counts them.
+	DELIVERY_BEST_EFFORT DeliveryMode = 0
+	// DELIVERY_BLOCK waits until the sink takes the result. The calls waiting
+	// hold their goroutine tickets, so a slow consumer slows down the run
+	// instead of losing results; memory stays bounded. Once stopping, they
+	// wait no longer than the stop grace period, then their results count as
+	// ignored, so a consumer may call Stop without reading on.
+	DELIVERY_BLOCK DeliveryMode = 1
+	// DELIVERY_SPILL appends what the sink has no room for to a temporary file
+	// and replays it to the sink in order, see lib.SpillSink. The run isn't
+	// slowed down, but stopping waits until the consumer has read everything.
+	DELIVERY_SPILL DeliveryMode = 2
+)
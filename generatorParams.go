@@ -10,41 +10,244 @@ import (
 )
 
 type NewLoadGeneratorParams struct {
+	// Caller is used through lib.NewContextCallerAdapter. Only a caller that
+	// implements lib.ContextCaller, or is set as ContextCaller, has its calls
+	// in flight cancelled on timeout and on Stop.
 	Caller               lib.Caller
+	ContextCaller        lib.ContextCaller
 	PPS                  uint64
 	ProcessingDurationNS time.Duration
 	TimeoutNS            time.Duration
-	ResultChan           chan *lib.CallResult
+	// ResultChan receives the results and is closed at the end of the run. It
+	// is used through lib.NewChannelSink; set either ResultChan or ResultSink.
+	ResultChan chan *lib.CallResult
+	ResultSink lib.ResultSink
+	// Delivery is what happens to a result the sink has no room for,
+	// DELIVERY_BEST_EFFORT by default. SpillDir is where DELIVERY_SPILL
+	// keeps its temporary file, the default temporary directory when empty.
+	Delivery DeliveryMode
+	SpillDir string
+	// Arrival shapes the gaps between payloads around the mean 1/PPS.
+	// Defaults to lib.NewConstantArrival() when nil.
+	Arrival lib.ArrivalDistribution
+	// Stages replaces the constant PPS with a multi-stage profile that is
+	// followed over the run, PPS must be left unset. ProcessingDurationNS
+	// defaults to the sum of the stage durations and caps the run when set.
+	Stages []Stage
+	// Shape replaces the constant PPS with a periodic profile, see Shape.
+	// ProcessingDurationNS is required as with PPS.
+	Shape *Shape
+	// Spikes are injected on top of the rate of PPS or Stages, see Spike.
+	// Payloads issued during a spike carry its index in CallResult.Spike, and
+	// EVENT_SPIKE_STARTED and EVENT_SPIKE_ENDED mark the spike windows.
+	Spikes []Spike
+	// VirtualUsers switches to the closed-loop model: that many users each send
+	// a payload, wait for its result and ThinkTimeNS, then send the next one.
+	// PPS, Stages and Arrival must be left unset in this mode.
+	VirtualUsers uint64
+	ThinkTimeNS  time.Duration
+	// Trace switches to replay mode: the recorded payloads are sent as they are,
+	// instead of calling BuildReq, each one at its offset divided by ReplaySpeed
+	// (1 when 0). The run ends with the trace, ProcessingDurationNS caps it when set.
+	// PPS, Stages, Arrival and VirtualUsers must be left unset in this mode.
+	Trace       lib.TraceSource
+	ReplaySpeed float64
+	// SchedulerTickNS is the shortest gap between two scheduler wake-ups,
+	// DEFAULT_SCHEDULER_TICK when 0. SchedulerBurst caps the payloads
+	// dispatched per wake-up and defaults to what is due in one tick at peak
+	// rate, or to the goroutine pool size in replay.
+	SchedulerTickNS time.Duration
+	SchedulerBurst  uint64
+	// StopGracePeriodNS is how long a stopping generator waits for calls in
+	// flight to deliver their results before closing the result sink. 0 abandons them right away.
+	StopGracePeriodNS time.Duration
+	// TotalRequests ends the run once that many payloads were sent and all their
+	// results delivered. ProcessingDurationNS becomes an optional cap then.
+	TotalRequests uint64
+	// WarmUpDurationNS is the start of the run whose results are tagged as
+	// WarmUp and left out of summaries. It counts towards ProcessingDurationNS.
+	WarmUpDurationNS time.Duration
+	// WindowNS is the interval of the time series, DEFAULT_WINDOW when 0. Every
+	// window is kept for Report and handed to WindowChan, when set, as soon as it
+	// ends; the last window of a run closes WindowChan.
+	WindowNS   time.Duration
+	WindowChan chan *lib.TimeWindow
+	// MaxInFlight caps the calls in flight at once. By default the cap is derived
+	// from the peak rate and the timeout, and follows SetPPS and SetTimeout.
+	MaxInFlight uint64
+	// Backpressure is what happens to a payload that finds the goroutine pool
+	// exhausted, BACKPRESSURE_BLOCK by default. BackpressureQueueSize bounds
+	// the queue of BACKPRESSURE_QUEUE. Dropped payloads don't count towards TotalRequests.
+	Backpressure          BackpressurePolicy
+	BackpressureQueueSize uint64
 }
 
 func (receiver *NewLoadGeneratorParams) Check() error {
 	helper.Logger.Info("Start Checking NewLoadGeneratorParams...")
 	var errMsgs []string
-	if receiver.Caller == nil {
+	if receiver.Caller == nil && receiver.ContextCaller == nil {
 		errMsgs = append(errMsgs, "Invalid caller!")
 	}
 
-	if receiver.ResultChan == nil {
+	if receiver.Caller != nil && receiver.ContextCaller != nil {
+		errMsgs = append(errMsgs, "Invalid caller, set either caller or contextCaller!")
+	}
+
+	if receiver.ResultChan == nil && receiver.ResultSink == nil {
 		errMsgs = append(errMsgs, "Invalid resultChan!")
 	}
 
-	if receiver.PPS == 0 {
-		errMsgs = append(errMsgs, "Invalid pps!")
+	if receiver.ResultChan != nil && receiver.ResultSink != nil {
+		errMsgs = append(errMsgs, "Invalid resultChan, set either resultChan or resultSink!")
+	}
+
+	if receiver.Trace != nil {
+		if receiver.PPS > 0 || len(receiver.Stages) > 0 || receiver.Shape != nil || receiver.Arrival != nil || receiver.VirtualUsers > 0 {
+			errMsgs = append(errMsgs, "Invalid trace, can't be combined with pps, stages, shape, arrival or virtualUsers!")
+		}
+
+		if receiver.ReplaySpeed < 0 {
+			errMsgs = append(errMsgs, "Invalid replaySpeed!")
+		}
+	} else if receiver.ReplaySpeed != 0 {
+		errMsgs = append(errMsgs, "Invalid replaySpeed, only used with trace!")
+	}
+
+	if receiver.Trace != nil {
+		if receiver.ThinkTimeNS != 0 {
+			errMsgs = append(errMsgs, "Invalid thinkTimeNS, only used with virtualUsers!")
+		}
+	} else if receiver.VirtualUsers > 0 {
+		if receiver.PPS > 0 || len(receiver.Stages) > 0 || receiver.Shape != nil || receiver.Arrival != nil {
+			errMsgs = append(errMsgs, "Invalid virtualUsers, can't be combined with pps, stages, shape or arrival!")
+		}
+
+		if receiver.Backpressure != BACKPRESSURE_BLOCK {
+			errMsgs = append(errMsgs, "Invalid backpressure, virtualUsers never outrun the pool!")
+		}
+
+		if receiver.ThinkTimeNS < 0 {
+			errMsgs = append(errMsgs, "Invalid thinkTimeNS!")
+		}
+
+		if receiver.ProcessingDurationNS == 0 && receiver.TotalRequests == 0 {
+			errMsgs = append(errMsgs, "Invalid processingDurationNS!")
+		}
+	} else if receiver.ThinkTimeNS != 0 {
+		errMsgs = append(errMsgs, "Invalid thinkTimeNS, only used with virtualUsers!")
+	} else if receiver.Shape != nil {
+		if receiver.PPS > 0 || len(receiver.Stages) > 0 {
+			errMsgs = append(errMsgs, "Invalid shape, can't be combined with pps or stages!")
+		}
+
+		errMsgs = append(errMsgs, receiver.Shape.check()...)
+
+		if receiver.ProcessingDurationNS == 0 && receiver.TotalRequests == 0 {
+			errMsgs = append(errMsgs, "Invalid processingDurationNS!")
+		}
+	} else if len(receiver.Stages) == 0 {
+		if receiver.PPS == 0 {
+			errMsgs = append(errMsgs, "Invalid pps!")
+		}
+
+		if receiver.ProcessingDurationNS == 0 && receiver.TotalRequests == 0 {
+			errMsgs = append(errMsgs, "Invalid processingDurationNS!")
+		}
+	} else {
+		if receiver.PPS > 0 {
+			errMsgs = append(errMsgs, "Invalid stages, can't be combined with pps!")
+		}
+
+		var peak uint64
+		for i, stage := range receiver.Stages {
+			errMsgs = append(errMsgs, stage.check(i)...)
+			if stage.PPS > peak {
+				peak = stage.PPS
+			}
+		}
+		if peak == 0 {
+			errMsgs = append(errMsgs, "Invalid stages, all stages have zero pps!")
+		}
+	}
+
+	if len(receiver.Spikes) > 0 && (receiver.VirtualUsers > 0 || receiver.Trace != nil) {
+		errMsgs = append(errMsgs, "Invalid spikes, can't be combined with virtualUsers or trace!")
+	}
+	for i, spike := range receiver.Spikes {
+		errMsgs = append(errMsgs, spike.check(i)...)
+	}
+
+	if receiver.WarmUpDurationNS < 0 || (receiver.ProcessingDurationNS > 0 && receiver.WarmUpDurationNS >= receiver.ProcessingDurationNS) {
+		errMsgs = append(errMsgs, "Invalid warmUpDurationNS!")
+	}
+
+	if receiver.MaxInFlight > 0 {
+		if receiver.MaxInFlight < receiver.SchedulerBurst {
+			errMsgs = append(errMsgs, "Invalid maxInFlight, below schedulerBurst!")
+		}
+
+		if receiver.MaxInFlight < receiver.VirtualUsers {
+			errMsgs = append(errMsgs, "Invalid maxInFlight, below virtualUsers!")
+		}
+	}
+
+	switch receiver.Backpressure {
+	case BACKPRESSURE_BLOCK, BACKPRESSURE_DROP:
+		if receiver.BackpressureQueueSize != 0 {
+			errMsgs = append(errMsgs, "Invalid backpressureQueueSize, only used with BACKPRESSURE_QUEUE!")
+		}
+	case BACKPRESSURE_QUEUE:
+		if receiver.BackpressureQueueSize == 0 {
+			errMsgs = append(errMsgs, "Invalid backpressureQueueSize!")
+		}
+	default:
+		errMsgs = append(errMsgs, "Invalid backpressure!")
 	}
 
-	if receiver.ProcessingDurationNS == 0 {
-		errMsgs = append(errMsgs, "Invalid processingDurationNS!")
+	switch receiver.Delivery {
+	case DELIVERY_BEST_EFFORT, DELIVERY_BLOCK:
+		if receiver.SpillDir != "" {
+			errMsgs = append(errMsgs, "Invalid spillDir, only used with DELIVERY_SPILL!")
+		}
+	case DELIVERY_SPILL:
+	default:
+		errMsgs = append(errMsgs, "Invalid delivery!")
+	}
+
+	if receiver.WindowNS < 0 {
+		errMsgs = append(errMsgs, "Invalid windowNS!")
+	}
+
+	if receiver.SchedulerTickNS < 0 {
+		errMsgs = append(errMsgs, "Invalid schedulerTickNS!")
+	}
+
+	if receiver.StopGracePeriodNS < 0 {
+		errMsgs = append(errMsgs, "Invalid stopGracePeriodNS!")
 	}
 
 	if receiver.TimeoutNS == 0 {
 		errMsgs = append(errMsgs, "Invalid timeoutNS!")
 	}
 
+	// A cap that always cuts the run short makes the count meaningless.
+	if receiver.TotalRequests > 0 && receiver.VirtualUsers == 0 && receiver.Trace == nil && len(errMsgs) == 0 {
+		profile := &loadProfile{pps: receiver.PPS, stages: receiver.Stages, shape: receiver.Shape, spikes: receiver.Spikes}
+		limit := receiver.ProcessingDurationNS
+		if limit == 0 {
+			limit = profile.duration()
+		}
+		// The tolerance absorbs the rounding of the integration.
+		if limit > 0 && float64(receiver.TotalRequests) > profile.payloadsWithin(limit)+1e-6 {
+			errMsgs = append(errMsgs, "Invalid totalRequests, can't be sent at the profile's rate within processingDurationNS!")
+		}
+	}
+
 	if len(errMsgs) > 0 {
 		errMsg := strings.Join(errMsgs, " ")
 		helper.Logger.Info("Didn't Pass Params Check", zap.String("err", errMsg))
 		return errors.New(errMsg)
 	}
-	helper.Logger.Info("Passed Params Check", zap.Uint64("pps", receiver.PPS), zap.Duration("timeoutNS", receiver.TimeoutNS), zap.Duration("processingDurationNS", receiver.ProcessingDurationNS))
+	helper.Logger.Info("Passed Params Check", zap.Uint64("pps", receiver.PPS), zap.Duration("timeoutNS", receiver.TimeoutNS), zap.Duration("processingDurationNS", receiver.ProcessingDurationNS), zap.Int("stages", len(receiver.Stages)), zap.Uint64("virtualUsers", receiver.VirtualUsers), zap.Bool("replay", receiver.Trace != nil), zap.Uint64("totalRequests", receiver.TotalRequests))
 	return nil
 }
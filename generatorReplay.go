@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"load-generator/helper"
+	"load-generator/lib"
+	"time"
+)
+
+const (
+	// DEFAULT_REPLAY_CONCURRENCY is the goroutine pool size of a replay without MaxInFlight, as the peak rate of a trace isn't known up front.
+	DEFAULT_REPLAY_CONCURRENCY uint64 = 1024
+)
+
+// genReplay plays the trace back in active time, each record due at its offset
+// divided by replaySpeed. Like genLoad, all records due on a wake-up are
+// dispatched as one batch of at most schedulerBurst. The run ends once the
+// trace is exhausted and every result was delivered.
+func (receiver *loadGenerator) genReplay() {
+	helper.Logger.Info("loadGenerator replaying trace...", zap.Float64("speed", receiver.replaySpeed), zap.Duration("tick", receiver.schedulerTickNS), zap.Uint64("burst", receiver.burst()))
+	var replayed int64
+	record, err := receiver.trace.Next()
+	lastWake := -receiver.schedulerTickNS
+	backlogged := false
+	for err == nil {
+		offset := time.Duration(float64(record.Offset) / receiver.replaySpeed)
+		wake := offset
+		if earliest := lastWake + receiver.schedulerTickNS; !backlogged && wake < earliest {
+			wake = earliest
+		}
+		if !receiver.waitForOffset(wake, nil) {
+			receiver.prepareToStop(receiver.ctx.Err())
+			return
+		}
+		due := receiver.clock.elapsed()
+		lastWake = due
+		var batch uint64
+		burst := receiver.burst()
+		var lagSum, lagMax time.Duration
+		for err == nil && offset <= due && batch < burst && receiver.claimRequest() {
+			replayed++
+			scheduledAt, _, _ := receiver.clock.wallTime(offset)
+			rawReq := lib.RawRequest{ID: replayed, Req: record.Payload}
+			receiver.asyncCall(scheduledCall{warmUp: offset < receiver.warmUpDurationNS, scheduledAt: scheduledAt, rawReq: &rawReq})
+			lag := time.Since(scheduledAt)
+			lagSum += lag
+			if lag > lagMax {
+				lagMax = lag
+			}
+			batch++
+			if record, err = receiver.trace.Next(); err == nil {
+				offset = time.Duration(float64(record.Offset) / receiver.replaySpeed)
+			}
+		}
+		backlogged = err == nil && offset <= due
+		receiver.scheduler.record(batch, lagSum, lagMax, backlogged)
+		if receiver.allIssued() {
+			break
+		}
+	}
+	if err != nil && err != io.EOF {
+		helper.Logger.Error("Read trace", zap.String("err", err.Error()), zap.Int64("replayed", replayed))
+	}
+	helper.Logger.Info("loadGenerator replayed trace", zap.Int64("replayed", replayed))
+	receiver.finishRun()
+}
+
+func replayArrivalName(speed float64) string {
+	return fmt.Sprintf("replay(speed=%.2fx)", speed)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"go.uber.org/zap"
+	"load-generator/helper"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// DEFAULT_SCHEDULER_TICK is the shortest gap between two scheduler wake-ups.
+	DEFAULT_SCHEDULER_TICK = time.Millisecond
+)
+
+// SchedulerStats describes how closely genLoad kept to its schedule.
+// Lag is the time between a payload's intended send time and its dispatch.
+type SchedulerStats struct {
+	Wakeups    uint64
+	Dispatched uint64
+	MaxBatch   uint64
+	// Backlogged counts wake-ups that hit the burst limit while more payloads were already due.
+	Backlogged uint64
+	MeanLag    time.Duration
+	MaxLag     time.Duration
+}
+
+type schedulerRecorder struct {
+	lock   sync.Mutex
+	stats  SchedulerStats
+	lagSum time.Duration
+}
+
+func (receiver *schedulerRecorder) reset() {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	receiver.stats = SchedulerStats{}
+	receiver.lagSum = 0
+}
+
+func (receiver *schedulerRecorder) record(batch uint64, lagSum time.Duration, lagMax time.Duration, backlogged bool) {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	receiver.stats.Wakeups++
+	receiver.stats.Dispatched += batch
+	if batch > receiver.stats.MaxBatch {
+		receiver.stats.MaxBatch = batch
+	}
+	if backlogged {
+		receiver.stats.Backlogged++
+	}
+	if lagMax > receiver.stats.MaxLag {
+		receiver.stats.MaxLag = lagMax
+	}
+	receiver.lagSum += lagSum
+}
+
+func (receiver *schedulerRecorder) snapshot() SchedulerStats {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	stats := receiver.stats
+	if stats.Dispatched > 0 {
+		stats.MeanLag = receiver.lagSum / time.Duration(stats.Dispatched)
+	}
+	return stats
+}
+
+// defaultSchedulerBurst is the number of payloads due within one tick at peak rate, plus one.
+func defaultSchedulerBurst(peakPPS uint64, tick time.Duration) uint64 {
+	return uint64(math.Ceil(float64(peakPPS)*tick.Seconds())) + 1
+}
+
+// genLoad works like a token bucket: the arrival distribution and the load
+// profile lay out an absolute schedule in active time, and on every wake-up all payloads
+// whose intended send time has passed are dispatched as one batch of at most
+// schedulerBurst. Wake-ups are at least schedulerTickNS apart, unless the
+// previous batch was cut short by the burst limit. Spikes are fired as soon as
+// they are due, regardless of the tick.
+func (receiver *loadGenerator) genLoad() {
+	helper.Logger.Info("loadGenerator generating payloads...", zap.String("arrival", receiver.arrival.Name()), zap.Duration("tick", receiver.schedulerTickNS), zap.Uint64("burst", receiver.burst()))
+	limit := receiver.processingDurationNS
+	if limit == 0 {
+		// Only totalRequests ends the run.
+		limit = math.MaxInt64
+	}
+	profile, profileChanged := receiver.currentProfile()
+	var offset time.Duration
+	ok := true
+	if rate, _ := profile.rateAt(0); rate <= 0 {
+		offset, ok = profile.advance(0, receiver.nextGap(profile, 0), limit)
+	}
+	spikes := newSpikeSchedule(profile.spikes)
+	currentStage := -1
+	lastWake := -receiver.schedulerTickNS
+	backlogged := false
+	for {
+		wake, waiting := offset, ok
+		if earliest := lastWake + receiver.schedulerTickNS; waiting && !backlogged && wake < earliest {
+			wake = earliest
+		}
+		if at, pending := spikes.nextAt(); pending && (!waiting || at < wake) {
+			wake, waiting = at, true
+		}
+		if !waiting {
+			// Nothing more is due before the run ends, unless the rate changes.
+			select {
+			case <-profileChanged:
+			case <-receiver.ctx.Done():
+				receiver.prepareToStop(receiver.ctx.Err())
+				return
+			}
+		} else {
+			if !receiver.waitForOffset(wake, profileChanged) {
+				receiver.prepareToStop(receiver.ctx.Err())
+				return
+			}
+		}
+		due := receiver.clock.elapsed()
+		if next, nextChanged := receiver.currentProfile(); next != profile {
+			// The rate changed, plan the next payload with the new profile from now on.
+			profile, profileChanged = next, nextChanged
+			if !ok || offset > due {
+				offset, ok = profile.advance(due, receiver.nextGap(profile, due), limit)
+			}
+			continue
+		}
+		receiver.fireSpikes(spikes, profile, due)
+		if receiver.allIssued() {
+			receiver.finishRun()
+			return
+		}
+		if !ok || offset > due {
+			continue
+		}
+		lastWake = due
+		var batch uint64
+		burst := receiver.burst()
+		var lagSum, lagMax time.Duration
+		for ok && offset <= due && batch < burst && receiver.claimRequest() {
+			_, stage := profile.rateAt(offset)
+			if stage != currentStage && len(profile.stages) > 0 {
+				helper.Logger.Info("loadGenerator entering stage", zap.Int("stage", stage), zap.Uint64("pps", profile.stages[stage].PPS))
+				currentStage = stage
+			}
+			scheduledAt, _, _ := receiver.clock.wallTime(offset)
+			receiver.asyncCall(scheduledCall{stage: stage, spike: spikeAt(profile.spikes, offset), warmUp: offset < receiver.warmUpDurationNS, scheduledAt: scheduledAt})
+			lag := time.Since(scheduledAt)
+			lagSum += lag
+			if lag > lagMax {
+				lagMax = lag
+			}
+			batch++
+			offset, ok = profile.advance(offset, receiver.nextGap(profile, offset), limit)
+		}
+		backlogged = ok && offset <= due
+		receiver.scheduler.record(batch, lagSum, lagMax, backlogged)
+		if receiver.allIssued() {
+			receiver.finishRun()
+			return
+		}
+	}
+}
+
+// nextGap draws the gap to the next payload starting at the point at, in units
+// of payloads. The arrival gets the mean gap of the rate in effect at that
+// point, or of the peak rate while the rate is zero, so gaps drawn in absolute
+// time keep their meaning.
+func (receiver *loadGenerator) nextGap(profile *loadProfile, at time.Duration) float64 {
+	rate, _ := profile.rateAt(at)
+	if rate <= 0 {
+		rate = float64(profile.peakPPS())
+	}
+	mean := time.Duration(float64(time.Second) / math.Max(rate, 1))
+	if mean <= 0 {
+		mean = 1
+	}
+	return float64(receiver.arrival.NextInterval(mean)) / float64(mean)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+type ShapeKind int
+
+const (
+	// SHAPE_SINE swings between MinPPS and MaxPPS, starting halfway and rising.
+	SHAPE_SINE ShapeKind = 0
+	// SHAPE_SQUARE holds MaxPPS for the first half of every period and MinPPS for the second.
+	SHAPE_SQUARE ShapeKind = 1
+	// SHAPE_DAILY follows Daily, 24 hourly points compressed into one period.
+	SHAPE_DAILY ShapeKind = 2
+)
+
+const dailyPoints = 24
+
+// Shape is a periodic load profile between MinPPS and MaxPPS that repeats every PeriodNS.
+type Shape struct {
+	Kind     ShapeKind
+	MinPPS   uint64
+	MaxPPS   uint64
+	PeriodNS time.Duration
+	// Daily holds the 24 hourly points of SHAPE_DAILY, each in [0, 1] between
+	// MinPPS and MaxPPS. The rate moves linearly from one point to the next.
+	Daily []float64
+}
+
+func (receiver *Shape) check() []string {
+	var errMsgs []string
+	if receiver.MaxPPS == 0 || receiver.MaxPPS < receiver.MinPPS {
+		errMsgs = append(errMsgs, "Invalid shape.MaxPPS!")
+	}
+	if receiver.PeriodNS <= 0 {
+		errMsgs = append(errMsgs, "Invalid shape.PeriodNS!")
+	}
+	switch receiver.Kind {
+	case SHAPE_SINE, SHAPE_SQUARE:
+		if len(receiver.Daily) > 0 {
+			errMsgs = append(errMsgs, "Invalid shape.Daily, only used with SHAPE_DAILY!")
+		}
+	case SHAPE_DAILY:
+		if len(receiver.Daily) != dailyPoints {
+			errMsgs = append(errMsgs, fmt.Sprintf("Invalid shape.Daily, expected %d points!", dailyPoints))
+		}
+		var highest float64
+		for i, point := range receiver.Daily {
+			if point < 0 || point > 1 {
+				errMsgs = append(errMsgs, fmt.Sprintf("Invalid shape.Daily[%d]!", i))
+			}
+			highest = math.Max(highest, point)
+		}
+		// A day that never rises above 0 pps wouldn't send anything.
+		if receiver.MinPPS == 0 && highest == 0 {
+			errMsgs = append(errMsgs, "Invalid shape.Daily, all points at zero pps!")
+		}
+	default:
+		errMsgs = append(errMsgs, "Invalid shape.Kind!")
+	}
+	return errMsgs
+}
+
+func (receiver *Shape) clone() *Shape {
+	if receiver == nil {
+		return nil
+	}
+	shape := *receiver
+	shape.Daily = append([]float64(nil), receiver.Daily...)
+	return &shape
+}
+
+// payloadsBetween integrates the rate from from to to in steps of
+// profileIntegrationStep. Whole periods are all alike and integrated once.
+func (receiver *Shape) payloadsBetween(from time.Duration, to time.Duration) float64 {
+	periods := (to - from) / receiver.PeriodNS
+	payloads := float64(periods) * receiver.integrate(0, receiver.PeriodNS)
+	return payloads + receiver.integrate(from+periods*receiver.PeriodNS, to)
+}
+
+func (receiver *Shape) integrate(from time.Duration, to time.Duration) float64 {
+	var payloads float64
+	for at := from; at < to; at += profileIntegrationStep {
+		width := profileIntegrationStep
+		if rest := to - at; rest < width {
+			width = rest
+		}
+		payloads += receiver.rateAt(at) * width.Seconds()
+	}
+	return payloads
+}
+
+// rateAt returns the rate of the shape at elapsed time since the run started.
+func (receiver *Shape) rateAt(elapsed time.Duration) float64 {
+	phase := float64(elapsed%receiver.PeriodNS) / float64(receiver.PeriodNS)
+	var level float64
+	switch receiver.Kind {
+	case SHAPE_SINE:
+		level = (1 + math.Sin(2*math.Pi*phase)) / 2
+	case SHAPE_SQUARE:
+		if phase < 0.5 {
+			level = 1
+		}
+	case SHAPE_DAILY:
+		position := phase * dailyPoints
+		hour := int(position)
+		next := (hour + 1) % dailyPoints
+		level = receiver.Daily[hour] + (receiver.Daily[next]-receiver.Daily[hour])*(position-float64(hour))
+	}
+	return float64(receiver.MinPPS) + (float64(receiver.MaxPPS)-float64(receiver.MinPPS))*level
+}
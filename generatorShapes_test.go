@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestShapeRateAt(t *testing.T) {
+	sine := &Shape{Kind: SHAPE_SINE, MinPPS: 100, MaxPPS: 300, PeriodNS: 4 * time.Second}
+	assert.InDelta(t, 200.0, sine.rateAt(0), 1e-9)
+	assert.InDelta(t, 300.0, sine.rateAt(time.Second), 1e-9)
+	assert.InDelta(t, 100.0, sine.rateAt(3*time.Second), 1e-9)
+	assert.InDelta(t, 300.0, sine.rateAt(5*time.Second), 1e-9)
+
+	square := &Shape{Kind: SHAPE_SQUARE, MinPPS: 100, MaxPPS: 300, PeriodNS: 4 * time.Second}
+	assert.Equal(t, 300.0, square.rateAt(time.Second))
+	assert.Equal(t, 100.0, square.rateAt(3*time.Second))
+
+	daily := &Shape{Kind: SHAPE_DAILY, MinPPS: 0, MaxPPS: 1000, PeriodNS: 24 * time.Second, Daily: make([]float64, 24)}
+	daily.Daily[12] = 1
+	assert.Equal(t, 0.0, daily.rateAt(6*time.Second))
+	assert.InDelta(t, 500.0, daily.rateAt(11500*time.Millisecond), 1e-9)
+	assert.InDelta(t, 1000.0, daily.rateAt(36*time.Second), 1e-9)
+
+	profile := &loadProfile{shape: sine}
+	assert.Equal(t, uint64(300), profile.peakPPS())
+	rate, stage := profile.rateAt(time.Second)
+	assert.InDelta(t, 300.0, rate, 1e-9)
+	assert.Equal(t, 0, stage)
+}
+
+func TestShapeCheck(t *testing.T) {
+	assert.Empty(t, (&Shape{Kind: SHAPE_SINE, MaxPPS: 10, PeriodNS: time.Second}).check())
+	assert.NotEmpty(t, (&Shape{Kind: SHAPE_SINE, MinPPS: 20, MaxPPS: 10, PeriodNS: time.Second}).check())
+	assert.NotEmpty(t, (&Shape{Kind: SHAPE_SQUARE, MaxPPS: 10}).check())
+	assert.NotEmpty(t, (&Shape{Kind: SHAPE_DAILY, MaxPPS: 10, PeriodNS: time.Second, Daily: []float64{1}}).check())
+	assert.NotEmpty(t, (&Shape{Kind: ShapeKind(7), MaxPPS: 10, PeriodNS: time.Second}).check())
+	// Shapes whose peak rate is 0 would never send anything.
+	assert.NotEmpty(t, (&Shape{Kind: SHAPE_SINE, PeriodNS: time.Second}).check())
+	assert.NotEmpty(t, (&Shape{Kind: SHAPE_DAILY, MaxPPS: 10, PeriodNS: time.Second, Daily: make([]float64, 24)}).check())
+	assert.Empty(t, (&Shape{Kind: SHAPE_DAILY, MinPPS: 1, MaxPPS: 10, PeriodNS: time.Second, Daily: make([]float64, 24)}).check())
+}
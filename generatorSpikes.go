@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"load-generator/helper"
+	"load-generator/lib"
+	"sort"
+	"time"
+)
+
+// Spike is injected on top of the base rate at AtNS of active time. It either
+// multiplies the rate by Factor for DurationNS, or fires Burst payloads at once.
+type Spike struct {
+	AtNS       time.Duration
+	DurationNS time.Duration
+	Factor     float64
+	Burst      uint64
+}
+
+func (receiver Spike) check(index int) []string {
+	var errMsgs []string
+	if receiver.AtNS < 0 {
+		errMsgs = append(errMsgs, fmt.Sprintf("Invalid spikes[%d].AtNS!", index))
+	}
+	if receiver.Burst > 0 {
+		if receiver.Factor != 0 || receiver.DurationNS != 0 {
+			errMsgs = append(errMsgs, fmt.Sprintf("Invalid spikes[%d], set either burst or factor and durationNS!", index))
+		}
+	} else if receiver.Factor <= 0 || receiver.DurationNS <= 0 {
+		errMsgs = append(errMsgs, fmt.Sprintf("Invalid spikes[%d], factor and durationNS must be positive!", index))
+	}
+	return errMsgs
+}
+
+func (receiver Spike) covers(elapsed time.Duration) bool {
+	return receiver.Burst == 0 && elapsed >= receiver.AtNS && elapsed < receiver.AtNS+receiver.DurationNS
+}
+
+// spikeAt returns the 1-based index of the last spike multiplying the rate at elapsed, 0 if none does.
+func spikeAt(spikes []Spike, elapsed time.Duration) int {
+	index := 0
+	for i, spike := range spikes {
+		if spike.covers(elapsed) {
+			index = i + 1
+		}
+	}
+	return index
+}
+
+// spikeEdge is the start or the end of a spike. Bursts only have a start.
+type spikeEdge struct {
+	at    time.Duration
+	index int
+	start bool
+}
+
+// spikeSchedule hands out the edges of the spikes in the order they are due.
+type spikeSchedule struct {
+	edges []spikeEdge
+	next  int
+}
+
+func newSpikeSchedule(spikes []Spike) *spikeSchedule {
+	schedule := &spikeSchedule{}
+	for i, spike := range spikes {
+		schedule.edges = append(schedule.edges, spikeEdge{at: spike.AtNS, index: i, start: true})
+		if spike.Burst == 0 {
+			schedule.edges = append(schedule.edges, spikeEdge{at: spike.AtNS + spike.DurationNS, index: i})
+		}
+	}
+	sort.SliceStable(schedule.edges, func(i, j int) bool { return schedule.edges[i].at < schedule.edges[j].at })
+	return schedule
+}
+
+// nextAt returns when the next edge is due, ok is false once all edges are passed.
+func (receiver *spikeSchedule) nextAt() (at time.Duration, ok bool) {
+	if receiver.next >= len(receiver.edges) {
+		return 0, false
+	}
+	return receiver.edges[receiver.next].at, true
+}
+
+// fireSpikes marks every spike edge that is due in the result stream and fires due bursts.
+func (receiver *loadGenerator) fireSpikes(schedule *spikeSchedule, profile *loadProfile, due time.Duration) {
+	for at, ok := schedule.nextAt(); ok && at <= due; at, ok = schedule.nextAt() {
+		edge := schedule.edges[schedule.next]
+		schedule.next++
+		spike := profile.spikes[edge.index]
+		rate, stage := profile.rateAt(edge.at)
+		if !edge.start {
+			helper.Logger.Info("loadGenerator spike ended", zap.Int("spike", edge.index+1))
+			receiver.sendEvent(&lib.Event{Type: lib.EVENT_SPIKE_ENDED, PPS: uint64(rate), TimeoutNS: receiver.timeout(), Spike: edge.index + 1})
+			continue
+		}
+		helper.Logger.Info("loadGenerator spike started", zap.Int("spike", edge.index+1), zap.Float64("factor", spike.Factor), zap.Uint64("burst", spike.Burst))
+		receiver.sendEvent(&lib.Event{Type: lib.EVENT_SPIKE_STARTED, PPS: uint64(rate), TimeoutNS: receiver.timeout(), Spike: edge.index + 1})
+		if spike.Burst == 0 {
+			continue
+		}
+		scheduledAt, _, _ := receiver.clock.wallTime(edge.at)
+		var batch uint64
+		for batch < spike.Burst && receiver.claimRequest() {
+			receiver.asyncCall(scheduledCall{stage: stage, spike: edge.index + 1, warmUp: edge.at < receiver.warmUpDurationNS, scheduledAt: scheduledAt})
+			batch++
+		}
+		lag := time.Since(scheduledAt)
+		receiver.scheduler.record(batch, lag*time.Duration(batch), lag, false)
+		receiver.sendEvent(&lib.Event{Type: lib.EVENT_SPIKE_ENDED, PPS: uint64(rate), TimeoutNS: receiver.timeout(), Spike: edge.index + 1})
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+type StageTransition int
+
+const (
+	// STAGE_TRANSITION_STEP jumps to the stage's PPS as soon as the stage begins.
+	STAGE_TRANSITION_STEP StageTransition = 0
+	// STAGE_TRANSITION_LINEAR ramps from the previous stage's PPS (0 for the
+	// first stage) to the stage's PPS over the stage duration.
+	STAGE_TRANSITION_LINEAR StageTransition = 1
+)
+
+// Stage is one segment of a multi-stage load profile.
+type Stage struct {
+	PPS        uint64
+	DurationNS time.Duration
+	Transition StageTransition
+}
+
+func (receiver Stage) check(index int) []string {
+	var errMsgs []string
+	if receiver.DurationNS <= 0 {
+		errMsgs = append(errMsgs, fmt.Sprintf("Invalid stages[%d].DurationNS!", index))
+	}
+	if receiver.Transition != STAGE_TRANSITION_STEP && receiver.Transition != STAGE_TRANSITION_LINEAR {
+		errMsgs = append(errMsgs, fmt.Sprintf("Invalid stages[%d].Transition!", index))
+	}
+	return errMsgs
+}
+
+// profileIntegrationStep is the resolution used to follow a changing rate.
+const profileIntegrationStep = 10 * time.Millisecond
+
+// loadProfile answers which rate applies at a given point of the run.
+type loadProfile struct {
+	pps    uint64
+	stages []Stage
+	shape  *Shape
+	spikes []Spike
+}
+
+// rateAt returns the target rate and the stage index at elapsed time since the run started,
+// multiplied by the spikes in effect. Past the last stage the last stage's rate is held.
+func (receiver *loadProfile) rateAt(elapsed time.Duration) (float64, int) {
+	rate, stage := receiver.baseRateAt(elapsed)
+	return rate * receiver.spikeFactor(elapsed), stage
+}
+
+// spikeFactor is the product of the factors of the spikes in effect at elapsed.
+func (receiver *loadProfile) spikeFactor(elapsed time.Duration) float64 {
+	factor := 1.0
+	for _, spike := range receiver.spikes {
+		if spike.covers(elapsed) {
+			factor *= spike.Factor
+		}
+	}
+	return factor
+}
+
+func (receiver *loadProfile) baseRateAt(elapsed time.Duration) (float64, int) {
+	if receiver.shape != nil {
+		return receiver.shape.rateAt(elapsed), 0
+	}
+	if len(receiver.stages) == 0 {
+		return float64(receiver.pps), 0
+	}
+	var from uint64
+	var stageStart time.Duration
+	for i, stage := range receiver.stages {
+		stageEnd := stageStart + stage.DurationNS
+		if elapsed < stageEnd {
+			if stage.Transition == STAGE_TRANSITION_STEP {
+				return float64(stage.PPS), i
+			}
+			progress := float64(elapsed-stageStart) / float64(stage.DurationNS)
+			return float64(from) + (float64(stage.PPS)-float64(from))*progress, i
+		}
+		from = stage.PPS
+		stageStart = stageEnd
+	}
+	last := len(receiver.stages) - 1
+	return float64(receiver.stages[last].PPS), last
+}
+
+// advance integrates the profile rate from the point from onwards and returns the
+// point at which the given number of events (in units of payloads) are due.
+// ok is false when that point lies at or beyond limit.
+func (receiver *loadProfile) advance(from time.Duration, events float64, limit time.Duration) (at time.Duration, ok bool) {
+	at = from
+	if events <= 0 {
+		return at, at < limit
+	}
+	steadyFrom, steady := receiver.steadyFrom()
+	step := profileIntegrationStep.Seconds()
+	for at < limit {
+		rate, _ := receiver.rateAt(at)
+		if rate <= 0 && steady && at >= steadyFrom {
+			// The rate stays at zero from here on, nothing is due anymore.
+			return limit, false
+		}
+		if rate*step >= events {
+			at += time.Duration(events / rate * 1e9)
+			return at, at < limit
+		}
+		events -= rate * step
+		at += profileIntegrationStep
+	}
+	return limit, false
+}
+
+// steadyFrom returns the point from which the rate no longer changes, after
+// the last stage and the last spike. steady is false under a shape, which keeps changing.
+func (receiver *loadProfile) steadyFrom() (at time.Duration, steady bool) {
+	if receiver.shape != nil {
+		return 0, false
+	}
+	at = receiver.duration()
+	for _, spike := range receiver.spikes {
+		if end := spike.AtNS + spike.DurationNS; end > at {
+			at = end
+		}
+	}
+	return at, true
+}
+
+// payloadsWithin counts the payloads the profile asks for before the point
+// until, spike bursts included. Between two stage or spike edges the rate is
+// constant or linear, so the rate halfway times the width is exact there; only
+// a shape is integrated numerically.
+func (receiver *loadProfile) payloadsWithin(until time.Duration) float64 {
+	edges := []time.Duration{0, until}
+	var stageEnd time.Duration
+	for _, stage := range receiver.stages {
+		stageEnd += stage.DurationNS
+		edges = append(edges, stageEnd)
+	}
+	var payloads float64
+	for _, spike := range receiver.spikes {
+		edges = append(edges, spike.AtNS, spike.AtNS+spike.DurationNS)
+		if spike.AtNS < until {
+			payloads += float64(spike.Burst)
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i] < edges[j] })
+	for i := 1; i < len(edges) && edges[i-1] < until; i++ {
+		from, to := edges[i-1], edges[i]
+		if to > until {
+			to = until
+		}
+		if to <= from {
+			continue
+		}
+		middle := from + (to-from)/2
+		if receiver.shape != nil {
+			payloads += receiver.spikeFactor(middle) * receiver.shape.payloadsBetween(from, to)
+			continue
+		}
+		rate, _ := receiver.rateAt(middle)
+		payloads += rate * (to - from).Seconds()
+	}
+	return payloads
+}
+
+// peakPPS is the highest rate the profile may reach, assuming spikes that raise the rate all overlap.
+func (receiver *loadProfile) peakPPS() uint64 {
+	peak := receiver.pps
+	if receiver.shape != nil {
+		peak = receiver.shape.MaxPPS
+	}
+	for _, stage := range receiver.stages {
+		if stage.PPS > peak {
+			peak = stage.PPS
+		}
+	}
+	factor := 1.0
+	for _, spike := range receiver.spikes {
+		if spike.Factor > 1 {
+			factor *= spike.Factor
+		}
+	}
+	return uint64(math.Ceil(float64(peak) * factor))
+}
+
+// peakBurst is the largest number of payloads a single spike fires at once.
+func (receiver *loadProfile) peakBurst() uint64 {
+	var peak uint64
+	for _, spike := range receiver.spikes {
+		if spike.Burst > peak {
+			peak = spike.Burst
+		}
+	}
+	return peak
+}
+
+func (receiver *loadProfile) duration() time.Duration {
+	var total time.Duration
+	for _, stage := range receiver.stages {
+		total += stage.DurationNS
+	}
+	return total
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"load-generator/lib"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLoadProfileRateAt(t *testing.T) {
+	profile := &loadProfile{stages: []Stage{
+		{PPS: 100, DurationNS: 10 * time.Second, Transition: STAGE_TRANSITION_LINEAR},
+		{PPS: 100, DurationNS: 20 * time.Second, Transition: STAGE_TRANSITION_STEP},
+		{PPS: 0, DurationNS: 10 * time.Second, Transition: STAGE_TRANSITION_LINEAR},
+	}}
+
+	rate, stage := profile.rateAt(0)
+	assert.Equal(t, 0.0, rate)
+	assert.Equal(t, 0, stage)
+
+	rate, stage = profile.rateAt(5 * time.Second)
+	assert.InDelta(t, 50.0, rate, 1e-9)
+	assert.Equal(t, 0, stage)
+
+	rate, stage = profile.rateAt(15 * time.Second)
+	assert.Equal(t, 100.0, rate)
+	assert.Equal(t, 1, stage)
+
+	rate, stage = profile.rateAt(32500 * time.Millisecond)
+	assert.InDelta(t, 75.0, rate, 1e-9)
+	assert.Equal(t, 2, stage)
+
+	rate, stage = profile.rateAt(time.Minute)
+	assert.Equal(t, 0.0, rate)
+	assert.Equal(t, 2, stage)
+
+	assert.Equal(t, uint64(100), profile.peakPPS())
+	assert.Equal(t, 40*time.Second, profile.duration())
+}
+
+func TestLoadProfileConstant(t *testing.T) {
+	profile := &loadProfile{pps: 1000}
+	rate, stage := profile.rateAt(time.Hour)
+	assert.Equal(t, 1000.0, rate)
+	assert.Equal(t, 0, stage)
+	assert.Equal(t, time.Duration(0), profile.duration())
+}
+
+func TestLoadProfileAdvance(t *testing.T) {
+	profile := &loadProfile{pps: 1000}
+	at, ok := profile.advance(0, 1, time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, time.Millisecond, at)
+
+	ramp := &loadProfile{stages: []Stage{
+		{PPS: 200, DurationNS: time.Second, Transition: STAGE_TRANSITION_LINEAR},
+	}}
+	// 100 payloads are due by the end of a 0 -> 200 pps ramp of one second.
+	at, ok = ramp.advance(0, 100, 2*time.Second)
+	assert.True(t, ok)
+	assert.InDelta(t, float64(time.Second), float64(at), float64(20*time.Millisecond))
+
+	_, ok = ramp.advance(0, 1000, 2*time.Second)
+	assert.False(t, ok)
+
+	// A profile that ends at zero pps gives up instead of stepping towards an unbounded limit.
+	idle := &loadProfile{stages: []Stage{{PPS: 100, DurationNS: time.Second}, {PPS: 0, DurationNS: time.Second}}}
+	at, ok = idle.advance(0, 1000, math.MaxInt64)
+	assert.False(t, ok)
+	assert.Equal(t, time.Duration(math.MaxInt64), at)
+}
+
+func TestTotalRequestsWithinProfile(t *testing.T) {
+	pset := NewLoadGeneratorParams{
+		Caller:        &sleepCaller{},
+		TimeoutNS:     50 * time.Millisecond,
+		Stages:        []Stage{{PPS: 100, DurationNS: time.Second}, {PPS: 0, DurationNS: time.Second}},
+		TotalRequests: 100,
+		ResultChan:    make(chan *lib.CallResult, 1),
+	}
+	assert.Nil(t, pset.Check())
+	pset.TotalRequests = 101
+	assert.NotNil(t, pset.Check())
+	pset.Spikes = []Spike{{AtNS: 1500 * time.Millisecond, Burst: 1}}
+	assert.Nil(t, pset.Check())
+
+	shape := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{},
+		TimeoutNS:            50 * time.Millisecond,
+		Shape:                &Shape{Kind: SHAPE_SQUARE, MinPPS: 0, MaxPPS: 100, PeriodNS: 2 * time.Second},
+		ProcessingDurationNS: 4 * time.Second,
+		TotalRequests:        200,
+		ResultChan:           make(chan *lib.CallResult, 1),
+	}
+	assert.Nil(t, shape.Check())
+	shape.TotalRequests = 201
+	assert.NotNil(t, shape.Check())
+	// Without processingDurationNS only totalRequests ends the run.
+	shape.ProcessingDurationNS = 0
+	assert.Nil(t, shape.Check())
+
+	// A 30-day soak is counted without stepping through it.
+	month := 30 * 24 * time.Hour
+	shape.ProcessingDurationNS = month
+	shape.TotalRequests = 50 * uint64(month/time.Second)
+	shape.Spikes = []Spike{{AtNS: time.Hour, DurationNS: time.Hour, Factor: 2}}
+	started := time.Now()
+	assert.Nil(t, shape.Check())
+	assert.Less(t, int64(time.Since(started)), int64(time.Second))
+	// The spike doubles the rate for an hour, one more payload is too many.
+	shape.TotalRequests += 50*3600 + 1
+	assert.NotNil(t, shape.Check())
+}
+
+func TestPayloadsWithin(t *testing.T) {
+	constant := &loadProfile{pps: 100, spikes: []Spike{{AtNS: time.Second, DurationNS: time.Second, Factor: 3}, {AtNS: 5 * time.Second, Burst: 7}}}
+	assert.InDelta(t, 100*10+200+7, constant.payloadsWithin(10*time.Second), 1e-6)
+
+	ramp := &loadProfile{stages: []Stage{
+		{PPS: 200, DurationNS: 2 * time.Second, Transition: STAGE_TRANSITION_LINEAR},
+		{PPS: 50, DurationNS: 2 * time.Second},
+	}}
+	assert.InDelta(t, 200+100, ramp.payloadsWithin(4*time.Second), 1e-6)
+	// The last stage's rate is held past the stages, the ramp cut halfway.
+	assert.InDelta(t, 200+100+50, ramp.payloadsWithin(5*time.Second), 1e-6)
+	assert.InDelta(t, 50, ramp.payloadsWithin(time.Second), 1e-6)
+
+	square := &loadProfile{shape: &Shape{Kind: SHAPE_SQUARE, MinPPS: 0, MaxPPS: 100, PeriodNS: 2 * time.Second}}
+	assert.InDelta(t, 100*5, square.payloadsWithin(10*time.Second), 1e-6)
+}
+
+func TestStagesCheck(t *testing.T) {
+	pset := NewLoadGeneratorParams{
+		Caller:     &sleepCaller{},
+		TimeoutNS:  50 * time.Millisecond,
+		Stages:     []Stage{{PPS: 100, DurationNS: time.Second}},
+		ResultChan: make(chan *lib.CallResult, 1),
+	}
+	assert.Nil(t, pset.Check())
+	// PPS would be ignored for the rate but still size the pool.
+	pset.PPS = 1000
+	assert.NotNil(t, pset.Check())
+}
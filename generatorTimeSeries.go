@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"load-generator/helper"
+	"load-generator/lib"
+	"time"
+)
+
+const (
+	// DEFAULT_WINDOW is the length of a time-series window.
+	DEFAULT_WINDOW = time.Second
+)
+
+// watchWindows closes a time-series window every windowNS until the run ends.
+func (receiver *loadGenerator) watchWindows(ctx context.Context) {
+	ticker := time.NewTicker(receiver.windowNS)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			receiver.closeWindow(now, false)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// closeWindow stores the current window and hands it to windowChan without
+// blocking. The last window of a run also closes windowChan.
+func (receiver *loadGenerator) closeWindow(now time.Time, last bool) {
+	receiver.windowLock.Lock()
+	defer receiver.windowLock.Unlock()
+	if receiver.windowsClosed {
+		return
+	}
+	window := receiver.windows.Rotate(now)
+	// Warm-up is measured in active time, as for the results, so pauses don't shorten it.
+	window.WarmUp = receiver.windowOffset < receiver.warmUpDurationNS
+	receiver.windowOffset = receiver.clock.elapsed()
+	receiver.timeSeries = append(receiver.timeSeries, *window)
+	if receiver.windowChan != nil {
+		select {
+		case receiver.windowChan <- window:
+		default:
+			helper.Logger.Info("Ignored time window", zap.Time("start", window.Start), zap.String("cause", "window channel is full"))
+		}
+	}
+	if last {
+		receiver.windowsClosed = true
+		if receiver.windowChan != nil {
+			close(receiver.windowChan)
+		}
+	}
+}
+
+// TimeSeries returns the windows closed so far in the last run.
+func (receiver *loadGenerator) TimeSeries() []lib.TimeWindow {
+	receiver.windowLock.Lock()
+	defer receiver.windowLock.Unlock()
+	return append([]lib.TimeWindow(nil), receiver.timeSeries...)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"load-generator/helper"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// genClosedLoad runs the closed-loop model: a fixed population of virtual users,
+// each one waiting for its previous call (and the think time) before sending the next.
+func (receiver *loadGenerator) genClosedLoad() {
+	helper.Logger.Info("loadGenerator running virtual users...", zap.Uint64("virtualUsers", receiver.virtualUsers), zap.Duration("thinkTimeNS", receiver.thinkTimeNS))
+	var wg sync.WaitGroup
+	for i := uint64(0); i < receiver.virtualUsers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			receiver.runVirtualUser()
+		}()
+	}
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-receiver.ctx.Done():
+	case <-finished:
+		// Every user gave up because totalRequests were sent, and as calls are
+		// synchronous their results have been delivered already.
+		receiver.ctxCancelFunc()
+	}
+	receiver.prepareToStop(receiver.ctx.Err())
+	<-finished
+}
+
+func (receiver *loadGenerator) runVirtualUser() {
+	// Waiting for the current offset only blocks while the run is paused.
+	for receiver.waitForOffset(receiver.clock.elapsed(), nil) && receiver.claimRequest() {
+		call := scheduledCall{warmUp: receiver.clock.elapsed() < receiver.warmUpDurationNS, scheduledAt: time.Now()}
+		receiver.ticketsImpl.Take()
+		atomic.AddInt64(&receiver.pendingCalls, 1)
+		receiver.syncCall(call)
+		receiver.ticketsImpl.PutBack()
+		if receiver.thinkTimeNS > 0 && !receiver.waitForOffset(receiver.clock.elapsed()+receiver.thinkTimeNS, nil) {
+			return
+		}
+	}
+}
+
+func closedLoopArrivalName(virtualUsers uint64, thinkTimeNS time.Duration) string {
+	return fmt.Sprintf("closed-loop(vus=%d, think=%v)", virtualUsers, thinkTimeNS)
+}
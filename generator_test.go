@@ -1,9 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"go.uber.org/zap"
 	"load-generator/helper"
 	"load-generator/lib"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -132,3 +139,1198 @@ func TestStop(t *testing.T) {
 	pps := float64(successCount) / float64(timeoutNS/1e9)
 	helper.Logger.Info("Result", zap.Int("tasks", total), zap.Uint64("Loads per second", pset.PPS), zap.Float64("Treatments per second", pps))
 }
+
+func TestPoissonArrival(t *testing.T) {
+
+	// 初始化服务器。
+	server := helper.NewTCPServer()
+	defer server.Close()
+	serverAddr := "127.0.0.1:8082"
+	t.Logf("Startup TCP server(%s)...\n", serverAddr)
+	err := server.Listen(serverAddr)
+	if err != nil {
+		t.Fatalf("TCP Server startup failing! (addr=%s)!\n", serverAddr)
+		t.FailNow()
+	}
+
+	// 初始化载荷发生器。
+	pset := NewLoadGeneratorParams{
+		Caller:               helper.NewTCPCallerClient(serverAddr),
+		TimeoutNS:            50 * time.Millisecond,
+		PPS:                  uint64(500),
+		ProcessingDurationNS: 2 * time.Second,
+		ResultChan:           make(chan *lib.CallResult, 50),
+		Arrival:              lib.NewPoissonArrival(time.Now().UnixNano()),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	gen.Start()
+
+	count := 0
+	for r := range pset.ResultChan {
+		if r.Arrival != "poisson" {
+			t.Fatalf("Unexpected arrival %q in result %d.\n", r.Arrival, r.ID)
+		}
+		count++
+	}
+	if count == 0 {
+		t.Fatalf("No result received.\n")
+	}
+	t.Logf("Received %d results, expected about %d.\n", count, 2*pset.PPS)
+}
+
+func TestCustomArrival(t *testing.T) {
+	// At least 20ms between payloads, whatever the rate asks for.
+	arrival, err := lib.NewCustomArrival("min-gap", func(mean time.Duration) time.Duration {
+		if mean < 20*time.Millisecond {
+			return 20 * time.Millisecond
+		}
+		return mean
+	})
+	if err != nil {
+		t.Fatalf("Custom arrival failing: %s\n", err)
+	}
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{},
+		TimeoutNS:            50 * time.Millisecond,
+		PPS:                  uint64(1000),
+		ProcessingDurationNS: time.Second,
+		ResultChan:           make(chan *lib.CallResult, 1000),
+		Arrival:              arrival,
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	gen.Start()
+	count := 0
+	for range pset.ResultChan {
+		count++
+	}
+	t.Logf("Received %d results, expected about 50.\n", count)
+	if count < 40 || count > 51 {
+		t.Fatalf("Received %d results, expected at most one per 20ms.\n", count)
+	}
+}
+
+func TestVirtualUsers(t *testing.T) {
+
+	// 初始化服务器。
+	server := helper.NewTCPServer()
+	defer server.Close()
+	serverAddr := "127.0.0.1:8083"
+	t.Logf("Startup TCP server(%s)...\n", serverAddr)
+	err := server.Listen(serverAddr)
+	if err != nil {
+		t.Fatalf("TCP Server startup failing! (addr=%s)!\n", serverAddr)
+		t.FailNow()
+	}
+
+	// 初始化载荷发生器。
+	pset := NewLoadGeneratorParams{
+		Caller:               helper.NewTCPCallerClient(serverAddr),
+		TimeoutNS:            50 * time.Millisecond,
+		VirtualUsers:         5,
+		ThinkTimeNS:          10 * time.Millisecond,
+		ProcessingDurationNS: 2 * time.Second,
+		ResultChan:           make(chan *lib.CallResult, 50),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	gen.Start()
+
+	count := 0
+	for range pset.ResultChan {
+		count++
+	}
+	// Every user sends at most one payload per think time.
+	if max := 5 * int(pset.ProcessingDurationNS/pset.ThinkTimeNS); count == 0 || count > max {
+		t.Fatalf("Unexpected result count %d, expected 1..%d.\n", count, max)
+	}
+	t.Logf("Received %d results from %d virtual users.\n", count, pset.VirtualUsers)
+}
+
+// sleepCaller answers every payload after a fixed delay, without any network.
+type sleepCaller struct {
+	delay time.Duration
+	id    int64
+}
+
+func (receiver *sleepCaller) BuildReq() lib.RawRequest {
+	return lib.RawRequest{ID: atomic.AddInt64(&receiver.id, 1), Req: []byte("ping")}
+}
+
+func (receiver *sleepCaller) Call(req []byte, timeoutNS time.Duration) ([]byte, error) {
+	time.Sleep(receiver.delay)
+	return []byte("pong"), nil
+}
+
+func (receiver *sleepCaller) CheckResp(req lib.RawRequest, resp lib.RawResponse) *lib.CallResult {
+	return &lib.CallResult{ID: resp.ID, Req: req, Resp: resp, Code: lib.RET_CODE_SUCCESS}
+}
+
+func TestResponseTimeIncludesQueueing(t *testing.T) {
+	// The caller holds every goroutine far longer than the timeout, so the pool
+	// of two tickets runs dry and the schedule falls behind.
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{delay: 200 * time.Millisecond},
+		TimeoutNS:            10 * time.Millisecond,
+		PPS:                  uint64(100),
+		ProcessingDurationNS: time.Second,
+		ResultChan:           make(chan *lib.CallResult, 200),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	gen.Start()
+
+	var maxResponseTime time.Duration
+	for r := range pset.ResultChan {
+		if r.ScheduledAt.IsZero() || r.StartedAt.Before(r.ScheduledAt) {
+			t.Fatalf("Unexpected schedule in result %d: scheduled=%v, started=%v.\n", r.ID, r.ScheduledAt, r.StartedAt)
+		}
+		if r.ResponseTime < r.Elapse {
+			t.Fatalf("Response time %v shorter than service time %v in result %d.\n", r.ResponseTime, r.Elapse, r.ID)
+		}
+		if r.ResponseTime > maxResponseTime {
+			maxResponseTime = r.ResponseTime
+		}
+	}
+	if maxResponseTime < 100*time.Millisecond {
+		t.Fatalf("Queueing delay not reflected, max response time %v.\n", maxResponseTime)
+	}
+	t.Logf("Max response time %v with timeout %v.\n", maxResponseTime, pset.TimeoutNS)
+}
+
+func TestSchedulerBatches(t *testing.T) {
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{},
+		TimeoutNS:            50 * time.Millisecond,
+		PPS:                  uint64(20000),
+		ProcessingDurationNS: time.Second,
+		SchedulerTickNS:      2 * time.Millisecond,
+		ResultChan:           make(chan *lib.CallResult, 20000),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	gen.Start()
+	for range pset.ResultChan {
+	}
+
+	stats := gen.SchedulerStats()
+	t.Logf("Scheduler stats: %+v\n", stats)
+	if stats.Dispatched < 19000 || stats.Dispatched > 20001 {
+		t.Fatalf("Unexpected dispatched count %d, expected about 20000.\n", stats.Dispatched)
+	}
+	if stats.Wakeups >= stats.Dispatched || stats.MaxBatch < 2 {
+		t.Fatalf("Payloads were not batched: %+v.\n", stats)
+	}
+	if stats.MeanLag > stats.MaxLag {
+		t.Fatalf("Mean lag %v above max lag %v.\n", stats.MeanLag, stats.MaxLag)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{delay: time.Millisecond},
+		TimeoutNS:            50 * time.Millisecond,
+		PPS:                  uint64(200),
+		ProcessingDurationNS: time.Second,
+		ResultChan:           make(chan *lib.CallResult, 500),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	if gen.Pause() {
+		t.Fatalf("Paused a generator that wasn't started.\n")
+	}
+	start := time.Now()
+	gen.Start()
+	pauseWindow := make(chan [2]time.Time, 1)
+	time.AfterFunc(300*time.Millisecond, func() {
+		pausedAt := time.Now()
+		gen.Pause()
+		if gen.Status() != STATUS_PAUSED {
+			t.Errorf("Unexpected status %d after Pause.\n", gen.Status())
+		}
+		time.Sleep(500 * time.Millisecond)
+		resumedAt := time.Now()
+		gen.Resume()
+		pauseWindow <- [2]time.Time{pausedAt, resumedAt}
+	})
+
+	var results []*lib.CallResult
+	for r := range pset.ResultChan {
+		results = append(results, r)
+	}
+	window := <-pauseWindow
+	for _, r := range results {
+		if r.ScheduledAt.After(window[0].Add(DEFAULT_SCHEDULER_TICK)) && r.ScheduledAt.Before(window[1]) {
+			t.Fatalf("Result %d scheduled at %v while paused (%v - %v), started at %v.\n", r.ID, r.ScheduledAt, window[0], window[1], r.StartedAt)
+		}
+	}
+	count := len(results)
+	if elapsed := time.Since(start); elapsed < 1500*time.Millisecond {
+		t.Fatalf("Run finished after %v, pause wasn't excluded from the duration.\n", elapsed)
+	}
+	if count < 180 || count > 201 {
+		t.Fatalf("Unexpected result count %d, expected about 200.\n", count)
+	}
+}
+
+func TestSetPPS(t *testing.T) {
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{delay: time.Millisecond},
+		TimeoutNS:            50 * time.Millisecond,
+		PPS:                  uint64(100),
+		ProcessingDurationNS: 2 * time.Second,
+		ResultChan:           make(chan *lib.CallResult, 2000),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	if gen.SetPPS(1000) {
+		t.Fatalf("Changed the rate of a generator that wasn't started.\n")
+	}
+	gen.Start()
+	time.AfterFunc(time.Second, func() {
+		if !gen.SetPPS(1000) || !gen.SetTimeout(100*time.Millisecond) {
+			t.Errorf("Couldn't reconfigure a running generator.\n")
+		}
+	})
+
+	var events []*lib.Event
+	before, after := 0, 0
+	for r := range pset.ResultChan {
+		if r.IsEvent() {
+			events = append(events, r.Event)
+			continue
+		}
+		if len(events) == 0 {
+			before++
+		} else {
+			after++
+		}
+	}
+	if len(events) != 2 || events[0].Type != lib.EVENT_RATE_CHANGED || events[0].PPS != 1000 ||
+		events[1].Type != lib.EVENT_TIMEOUT_CHANGED || events[1].TimeoutNS != 100*time.Millisecond {
+		t.Fatalf("Unexpected events %+v.\n", events)
+	}
+	if before < 90 || before > 110 || after < 900 || after > 1010 {
+		t.Fatalf("Unexpected result counts %d before and %d after the rate change.\n", before, after)
+	}
+}
+
+func TestSetPPSBurst(t *testing.T) {
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{},
+		TimeoutNS:            50 * time.Millisecond,
+		PPS:                  uint64(100),
+		ProcessingDurationNS: time.Second,
+		SchedulerTickNS:      2 * time.Millisecond,
+		ResultChan:           make(chan *lib.CallResult, 20000),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	gen.Start()
+	time.AfterFunc(200*time.Millisecond, func() {
+		gen.SetPPS(20000)
+	})
+	for range pset.ResultChan {
+	}
+	// At 100 pps a burst of 2 would do, at 20000 pps about 41 are due per tick.
+	stats := gen.SchedulerStats()
+	t.Logf("Scheduler stats: %+v\n", stats)
+	if stats.MaxBatch <= 2 {
+		t.Fatalf("Payloads were not batched after the rate change: %+v.\n", stats)
+	}
+}
+
+func TestStopGracePeriod(t *testing.T) {
+	for _, grace := range []time.Duration{0, time.Second} {
+		pset := NewLoadGeneratorParams{
+			Caller:               &sleepCaller{delay: 300 * time.Millisecond},
+			TimeoutNS:            time.Second,
+			PPS:                  uint64(100),
+			ProcessingDurationNS: 500 * time.Millisecond,
+			StopGracePeriodNS:    grace,
+			ResultChan:           make(chan *lib.CallResult, 100),
+		}
+		gen, err := NewLoadGenerator(pset)
+		if err != nil {
+			t.Fatalf("Load generator initialization failing: %s\n",
+				err)
+			t.FailNow()
+		}
+
+		gen.Start()
+		count := 0
+		for range pset.ResultChan {
+			count++
+		}
+		delivered := uint64(count) + gen.AbandonedCount()
+		t.Logf("Grace period %v: %d delivered, %d abandoned.\n", grace, count, gen.AbandonedCount())
+		if delivered != gen.CallCount() {
+			t.Fatalf("%d results and %d abandoned calls don't add up to %d calls.\n", count, gen.AbandonedCount(), gen.CallCount())
+		}
+		if grace > 0 && gen.AbandonedCount() != 0 {
+			t.Fatalf("%d calls abandoned despite a grace period of %v.\n", gen.AbandonedCount(), grace)
+		}
+		if grace == 0 && gen.AbandonedCount() == 0 {
+			t.Fatalf("No call abandoned without a grace period.\n")
+		}
+	}
+}
+
+// ctxSleepCaller is a sleepCaller whose calls give up once their context is done.
+type ctxSleepCaller struct {
+	sleepCaller
+}
+
+func (receiver *ctxSleepCaller) CallContext(ctx context.Context, req []byte) ([]byte, error) {
+	select {
+	case <-time.After(receiver.delay):
+		return []byte("pong"), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestRestart(t *testing.T) {
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{delay: time.Millisecond},
+		TimeoutNS:            time.Second,
+		PPS:                  uint64(100),
+		ProcessingDurationNS: 10 * time.Second,
+		ResultChan:           make(chan *lib.CallResult, 100),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	if !gen.Start() {
+		t.Fatalf("First start refused.\n")
+	}
+	time.AfterFunc(300*time.Millisecond, func() {
+		gen.Stop()
+	})
+	count := 0
+	for range pset.ResultChan {
+		count++
+	}
+	if count == 0 || uint64(count) != gen.CallCount() {
+		t.Fatalf("Expected a result for each of %d calls, received %d.\n", gen.CallCount(), count)
+	}
+	// The result channel is closed, a second run would have nowhere to deliver to.
+	if gen.Start() {
+		t.Fatalf("Restart of a stopped generator accepted.\n")
+	}
+	if gen.Status() != STATUS_STOPPED || gen.CallCount() != uint64(count) {
+		t.Fatalf("Refused restart changed the generator: status %d, %d calls.\n", gen.Status(), gen.CallCount())
+	}
+}
+
+// failSleepCaller is a sleepCaller that fails every call once it returns.
+type failSleepCaller struct {
+	sleepCaller
+}
+
+func (receiver *failSleepCaller) Call(req []byte, timeoutNS time.Duration) ([]byte, error) {
+	time.Sleep(receiver.delay)
+	return nil, errors.New("connection reset")
+}
+
+func TestCallCancellation(t *testing.T) {
+	for _, kind := range []string{"plain", "failing", "context"} {
+		cancellable := kind == "context"
+		pset := NewLoadGeneratorParams{
+			TimeoutNS:            20 * time.Millisecond,
+			PPS:                  uint64(100),
+			ProcessingDurationNS: 500 * time.Millisecond,
+			StopGracePeriodNS:    time.Second,
+			ResultChan:           make(chan *lib.CallResult, 100),
+		}
+		switch kind {
+		case "context":
+			pset.ContextCaller = &ctxSleepCaller{sleepCaller{delay: 100 * time.Millisecond}}
+		case "failing":
+			// Its errors come after the deadline, but aren't caused by it.
+			pset.Caller = &failSleepCaller{sleepCaller{delay: 100 * time.Millisecond}}
+		default:
+			pset.Caller = &sleepCaller{delay: 100 * time.Millisecond}
+		}
+		gen, err := NewLoadGenerator(pset)
+		if err != nil {
+			t.Fatalf("Load generator initialization failing: %s\n",
+				err)
+			t.FailNow()
+		}
+
+		gen.Start()
+		for r := range pset.ResultChan {
+			if r.Code != lib.RET_CODE_WARNING_TIMEOUT {
+				t.Fatalf("Unexpected code %d in result %d.\n", r.Code, r.ID)
+			}
+		}
+		// Late completions are only counted once the calls really return.
+		time.Sleep(200 * time.Millisecond)
+		t.Logf("%s caller: %d calls, %d cancelled, %d late.\n", kind, gen.CallCount(), gen.CancelledCount(), gen.LateCount())
+		if cancellable && (gen.CancelledCount() != gen.CallCount() || gen.LateCount() != 0) {
+			t.Fatalf("Expected all %d calls to be cancelled.\n", gen.CallCount())
+		}
+		if !cancellable && (gen.LateCount() != gen.CallCount() || gen.CancelledCount() != 0) {
+			t.Fatalf("Expected all %d calls to complete late.\n", gen.CallCount())
+		}
+	}
+}
+
+func TestTotalRequests(t *testing.T) {
+	for _, virtualUsers := range []uint64{0, 4} {
+		pset := NewLoadGeneratorParams{
+			Caller:        &sleepCaller{delay: 5 * time.Millisecond},
+			TimeoutNS:     50 * time.Millisecond,
+			TotalRequests: 300,
+			ResultChan:    make(chan *lib.CallResult, 300),
+		}
+		if virtualUsers > 0 {
+			pset.VirtualUsers = virtualUsers
+		} else {
+			pset.PPS = 1000
+		}
+		gen, err := NewLoadGenerator(pset)
+		if err != nil {
+			t.Fatalf("Load generator initialization failing: %s\n",
+				err)
+			t.FailNow()
+		}
+
+		gen.Start()
+		count := 0
+		for r := range pset.ResultChan {
+			if r.Code != lib.RET_CODE_SUCCESS {
+				t.Fatalf("Unexpected code %d in result %d.\n", r.Code, r.ID)
+			}
+			count++
+		}
+		if count != int(pset.TotalRequests) || gen.CallCount() != pset.TotalRequests {
+			t.Fatalf("Virtual users %d: %d results of %d calls, expected %d.\n", virtualUsers, count, gen.CallCount(), pset.TotalRequests)
+		}
+	}
+
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{},
+		TimeoutNS:            50 * time.Millisecond,
+		PPS:                  100,
+		ProcessingDurationNS: time.Second,
+		TotalRequests:        1000,
+		ResultChan:           make(chan *lib.CallResult, 1),
+	}
+	if _, err := NewLoadGenerator(pset); err == nil {
+		t.Fatalf("Accepted %d requests at %d pps within %v.\n", pset.TotalRequests, pset.PPS, pset.ProcessingDurationNS)
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{delay: time.Millisecond},
+		TimeoutNS:            50 * time.Millisecond,
+		PPS:                  uint64(200),
+		ProcessingDurationNS: time.Second,
+		WarmUpDurationNS:     300 * time.Millisecond,
+		ResultChan:           make(chan *lib.CallResult, 200),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	gen.Start()
+	warmUp, measured := 0, 0
+	var lastWarmUp, firstMeasured time.Time
+	for r := range pset.ResultChan {
+		if r.WarmUp {
+			warmUp++
+			if r.ScheduledAt.After(lastWarmUp) {
+				lastWarmUp = r.ScheduledAt
+			}
+		} else {
+			measured++
+			if firstMeasured.IsZero() || r.ScheduledAt.Before(firstMeasured) {
+				firstMeasured = r.ScheduledAt
+			}
+		}
+	}
+	if warmUp < 55 || warmUp > 65 || measured < 130 || measured > 145 {
+		t.Fatalf("Unexpected split of %d warm-up and %d measured results.\n", warmUp, measured)
+	}
+	if !lastWarmUp.Before(firstMeasured) {
+		t.Fatalf("Warm-up result scheduled at %v after measured result at %v.\n", lastWarmUp, firstMeasured)
+	}
+
+	pset.WarmUpDurationNS = pset.ProcessingDurationNS
+	if _, err := NewLoadGenerator(pset); err == nil {
+		t.Fatalf("Accepted a warm-up as long as the run.\n")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	// 200 records over one second, replayed at double speed.
+	var records []lib.TraceRecord
+	for i := 0; i < 200; i++ {
+		records = append(records, lib.TraceRecord{Offset: time.Duration(i) * 5 * time.Millisecond, Payload: []byte(fmt.Sprintf("req-%d", i))})
+	}
+	pset := NewLoadGeneratorParams{
+		Caller:      &sleepCaller{delay: time.Millisecond},
+		TimeoutNS:   50 * time.Millisecond,
+		Trace:       lib.NewTraceSlice(records),
+		ReplaySpeed: 2,
+		// About 4 records are due per tick.
+		SchedulerTickNS: 10 * time.Millisecond,
+		ResultChan:      make(chan *lib.CallResult, 200),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	start := time.Now()
+	gen.Start()
+	count := 0
+	for r := range pset.ResultChan {
+		if r.Code != lib.RET_CODE_SUCCESS {
+			t.Fatalf("Unexpected code %d in result %d.\n", r.Code, r.ID)
+		}
+		if expected := fmt.Sprintf("req-%d", r.ID-1); string(r.Req.Req) != expected {
+			t.Fatalf("Result %d sent %q, expected the recorded %q.\n", r.ID, r.Req.Req, expected)
+		}
+		if offset := r.ScheduledAt.Sub(start); offset < records[r.ID-1].Offset/2 {
+			t.Fatalf("Result %d scheduled %v into the run, before its replay offset %v.\n", r.ID, offset, records[r.ID-1].Offset/2)
+		}
+		count++
+	}
+	elapsed := time.Since(start)
+	if count != len(records) {
+		t.Fatalf("%d results, expected %d.\n", count, len(records))
+	}
+	if elapsed < 450*time.Millisecond || elapsed > 800*time.Millisecond {
+		t.Fatalf("Replay at 2x took %v, expected about 500ms.\n", elapsed)
+	}
+	if stats := gen.SchedulerStats(); stats.MaxBatch < 2 || stats.Dispatched != uint64(len(records)) {
+		t.Fatalf("Records were not batched: %+v.\n", stats)
+	}
+	if gen.SetPPS(100) {
+		t.Fatalf("Changed the rate of a replay.\n")
+	}
+
+	pset.PPS = 100
+	if _, err := NewLoadGenerator(pset); err == nil {
+		t.Fatalf("Accepted a trace combined with pps.\n")
+	}
+}
+
+func TestSpikes(t *testing.T) {
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{delay: time.Millisecond},
+		TimeoutNS:            50 * time.Millisecond,
+		PPS:                  uint64(100),
+		ProcessingDurationNS: time.Second,
+		Spikes: []Spike{
+			{AtNS: 300 * time.Millisecond, DurationNS: 200 * time.Millisecond, Factor: 5},
+			{AtNS: 700 * time.Millisecond, Burst: 50},
+		},
+		ResultChan: make(chan *lib.CallResult, 1000),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	gen.Start()
+	var events []*lib.Event
+	counts := map[int]int{}
+	for r := range pset.ResultChan {
+		if r.IsEvent() {
+			events = append(events, r.Event)
+			continue
+		}
+		counts[r.Spike]++
+	}
+	t.Logf("Results per spike: %v.\n", counts)
+	expected := []lib.EventType{lib.EVENT_SPIKE_STARTED, lib.EVENT_SPIKE_ENDED, lib.EVENT_SPIKE_STARTED, lib.EVENT_SPIKE_ENDED}
+	if len(events) != len(expected) {
+		t.Fatalf("Unexpected events %+v.\n", events)
+	}
+	for i, event := range events {
+		if event.Type != expected[i] || event.Spike != i/2+1 {
+			t.Fatalf("Unexpected event %d: %+v.\n", i, event)
+		}
+	}
+	if events[1].Time.Sub(events[0].Time) < 190*time.Millisecond {
+		t.Fatalf("Spike window %v shorter than its duration.\n", events[1].Time.Sub(events[0].Time))
+	}
+	if counts[1] < 90 || counts[1] > 101 || counts[2] != 50 || counts[0] < 75 || counts[0] > 81 {
+		t.Fatalf("Unexpected results per spike %v.\n", counts)
+	}
+
+	pset.Spikes = []Spike{{AtNS: time.Second, Factor: 2}}
+	if _, err := NewLoadGenerator(pset); err == nil {
+		t.Fatalf("Accepted a spike without a duration.\n")
+	}
+}
+
+func TestShape(t *testing.T) {
+	// One square period: 400 pps for half a second, then 100 pps.
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{delay: time.Millisecond},
+		TimeoutNS:            50 * time.Millisecond,
+		Shape:                &Shape{Kind: SHAPE_SQUARE, MinPPS: 100, MaxPPS: 400, PeriodNS: time.Second},
+		ProcessingDurationNS: time.Second,
+		ResultChan:           make(chan *lib.CallResult, 500),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	start := time.Now()
+	gen.Start()
+	high, low := 0, 0
+	for r := range pset.ResultChan {
+		if r.ScheduledAt.Sub(start) < 500*time.Millisecond {
+			high++
+		} else {
+			low++
+		}
+	}
+	if high < 190 || high > 201 || low < 45 || low > 51 {
+		t.Fatalf("Unexpected result counts %d at max and %d at min rate.\n", high, low)
+	}
+
+	pset.PPS = 100
+	if _, err := NewLoadGenerator(pset); err == nil {
+		t.Fatalf("Accepted a shape combined with pps.\n")
+	}
+}
+
+func TestBackpressure(t *testing.T) {
+	for _, policy := range []BackpressurePolicy{BACKPRESSURE_BLOCK, BACKPRESSURE_DROP, BACKPRESSURE_QUEUE} {
+		// Every call holds its ticket ten times longer than the timeout the pool is sized for.
+		pset := NewLoadGeneratorParams{
+			Caller:               &sleepCaller{delay: 100 * time.Millisecond},
+			TimeoutNS:            10 * time.Millisecond,
+			PPS:                  uint64(100),
+			ProcessingDurationNS: time.Second,
+			Backpressure:         policy,
+			ResultChan:           make(chan *lib.CallResult, 200),
+		}
+		if policy == BACKPRESSURE_QUEUE {
+			pset.BackpressureQueueSize = 10
+		}
+		gen, err := NewLoadGenerator(pset)
+		if err != nil {
+			t.Fatalf("Load generator initialization failing: %s\n",
+				err)
+			t.FailNow()
+		}
+
+		gen.Start()
+		count := 0
+		for range pset.ResultChan {
+			count++
+		}
+		stats := gen.BackpressureStats()
+		t.Logf("Policy %d: %d results, %+v.\n", policy, count, stats)
+		switch policy {
+		case BACKPRESSURE_BLOCK:
+			if stats.Blocked == 0 || stats.Dropped != 0 || count > 60 {
+				t.Fatalf("Blocking policy: %d results, %+v.\n", count, stats)
+			}
+		case BACKPRESSURE_DROP:
+			if stats.Dropped < 50 || stats.Queued != 0 || count+int(stats.Dropped) < 99 || count+int(stats.Dropped) > 101 {
+				t.Fatalf("Dropping policy: %d results, %+v.\n", count, stats)
+			}
+		case BACKPRESSURE_QUEUE:
+			if stats.Queued == 0 || stats.Dropped == 0 || count+int(stats.Dropped) < 99 || count+int(stats.Dropped) > 101 {
+				t.Fatalf("Queueing policy: %d results, %+v.\n", count, stats)
+			}
+		}
+	}
+
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{},
+		TimeoutNS:            10 * time.Millisecond,
+		PPS:                  uint64(100),
+		ProcessingDurationNS: time.Second,
+		Backpressure:         BACKPRESSURE_QUEUE,
+		ResultChan:           make(chan *lib.CallResult, 1),
+	}
+	if _, err := NewLoadGenerator(pset); err == nil {
+		t.Fatalf("Accepted a queue without a size.\n")
+	}
+}
+
+func TestBackpressureQueuePaused(t *testing.T) {
+	pset := NewLoadGeneratorParams{
+		Caller:                &sleepCaller{delay: 100 * time.Millisecond},
+		TimeoutNS:             10 * time.Millisecond,
+		PPS:                   uint64(100),
+		ProcessingDurationNS:  time.Second,
+		Backpressure:          BACKPRESSURE_QUEUE,
+		BackpressureQueueSize: 50,
+		ResultChan:            make(chan *lib.CallResult, 200),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	gen.Start()
+	pauseWindow := make(chan [2]time.Time, 1)
+	time.AfterFunc(300*time.Millisecond, func() {
+		pausedAt := time.Now()
+		gen.Pause()
+		time.Sleep(500 * time.Millisecond)
+		resumedAt := time.Now()
+		gen.Resume()
+		pauseWindow <- [2]time.Time{pausedAt, resumedAt}
+	})
+
+	var results []*lib.CallResult
+	for r := range pset.ResultChan {
+		results = append(results, r)
+	}
+	window := <-pauseWindow
+	for _, r := range results {
+		if r.StartedAt.After(window[0].Add(10*time.Millisecond)) && r.StartedAt.Before(window[1]) {
+			t.Fatalf("Queued call %d started at %v while paused (%v - %v).\n", r.ID, r.StartedAt, window[0], window[1])
+		}
+	}
+	if stats := gen.BackpressureStats(); stats.Queued == 0 {
+		t.Fatalf("Nothing was queued, %+v.\n", stats)
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	for _, maxInFlight := range []uint64{0, 4} {
+		pset := NewLoadGeneratorParams{
+			Caller:               &sleepCaller{delay: 50 * time.Millisecond},
+			TimeoutNS:            100 * time.Millisecond,
+			PPS:                  uint64(200),
+			ProcessingDurationNS: 500 * time.Millisecond,
+			StopGracePeriodNS:    time.Second,
+			MaxInFlight:          maxInFlight,
+			Backpressure:         BACKPRESSURE_DROP,
+			ResultChan:           make(chan *lib.CallResult, 200),
+		}
+		gen, err := NewLoadGenerator(pset)
+		if err != nil {
+			t.Fatalf("Load generator initialization failing: %s\n",
+				err)
+			t.FailNow()
+		}
+
+		gen.Start()
+		for range pset.ResultChan {
+		}
+		peak, dropped := gen.PeakInFlight(), gen.BackpressureStats().Dropped
+		t.Logf("Max in flight %d: peak %d, %d dropped.\n", maxInFlight, peak, dropped)
+		if maxInFlight > 0 && (peak != maxInFlight || dropped == 0) {
+			t.Fatalf("Peak %d with %d dropped, expected the cap of %d to be reached.\n", peak, dropped, maxInFlight)
+		}
+		// About ten calls are in flight at 200 pps for 50ms each.
+		if maxInFlight == 0 && (peak < 8 || dropped != 0) {
+			t.Fatalf("Peak %d with %d dropped under the derived pool size.\n", peak, dropped)
+		}
+	}
+
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{},
+		TimeoutNS:            100 * time.Millisecond,
+		VirtualUsers:         8,
+		ProcessingDurationNS: time.Second,
+		MaxInFlight:          4,
+		ResultChan:           make(chan *lib.CallResult, 1),
+	}
+	if _, err := NewLoadGenerator(pset); err == nil {
+		t.Fatalf("Accepted fewer in flight than virtual users.\n")
+	}
+}
+
+func TestReport(t *testing.T) {
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{delay: time.Millisecond},
+		TimeoutNS:            50 * time.Millisecond,
+		PPS:                  uint64(200),
+		ProcessingDurationNS: time.Second,
+		WarmUpDurationNS:     200 * time.Millisecond,
+		ResultChan:           make(chan *lib.CallResult, 20),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	gen.Start()
+	// Read slowly enough for the channel to overflow now and then.
+	delivered := 0
+	for range pset.ResultChan {
+		delivered++
+		if delivered%10 == 0 {
+			time.Sleep(60 * time.Millisecond)
+		}
+	}
+	report := gen.Report()
+	t.Logf("Report:\n%s", report)
+
+	if report.Metadata.Mode != "open-loop" || report.Metadata.PPS != 200 || report.Metadata.EndedAt.IsZero() {
+		t.Fatalf("Unexpected metadata %+v.\n", report.Metadata)
+	}
+	if report.Offered < 195 || report.Offered > 201 || report.OfferedPPS < 190 || report.OfferedPPS > 205 {
+		t.Fatalf("Offered %d payloads at %.2f pps, expected 200 at 200 pps.\n", report.Offered, report.OfferedPPS)
+	}
+	if report.AchievedPPS < 185 || report.AchievedPPS > 205 {
+		t.Fatalf("Achieved %.2f pps, expected about 200.\n", report.AchievedPPS)
+	}
+	if len(report.Codes) != 1 || report.Codes[0].Label != "Success" || report.Codes[0].Count != report.SuccessLatency.Count {
+		t.Fatalf("Unexpected codes %+v.\n", report.Codes)
+	}
+	if count := report.SuccessLatency.Count; count < 155 || count > 161 {
+		t.Fatalf("%d successes counted, expected about 160 after the warm-up.\n", count)
+	}
+	if report.SuccessLatency.P50 < time.Millisecond || report.SuccessLatency.P99999 < report.SuccessLatency.P50 {
+		t.Fatalf("Unexpected latency %+v.\n", report.SuccessLatency)
+	}
+	if report.Ignored == 0 || uint64(delivered)+report.Ignored != report.Calls {
+		t.Fatalf("%d delivered and %d ignored of %d calls.\n", delivered, report.Ignored, report.Calls)
+	}
+
+	data, err := report.JSON()
+	if err != nil {
+		t.Fatalf("Report serialization failing: %s\n", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Offered != report.Offered || decoded.SuccessLatency != report.SuccessLatency {
+		t.Fatalf("Report didn't survive JSON: %s\n", data)
+	}
+}
+
+func TestTimeSeries(t *testing.T) {
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{delay: time.Millisecond},
+		TimeoutNS:            50 * time.Millisecond,
+		PPS:                  uint64(200),
+		ProcessingDurationNS: time.Second,
+		WindowNS:             250 * time.Millisecond,
+		WindowChan:           make(chan *lib.TimeWindow, 10),
+		ResultChan:           make(chan *lib.CallResult, 200),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	gen.Start()
+	live := make(chan []*lib.TimeWindow)
+	go func() {
+		var windows []*lib.TimeWindow
+		for window := range pset.WindowChan {
+			windows = append(windows, window)
+		}
+		live <- windows
+	}()
+	results := 0
+	for range pset.ResultChan {
+		results++
+	}
+	windows := <-live
+
+	stored := gen.TimeSeries()
+	if len(windows) < 4 || len(windows) > 5 || len(stored) != len(windows) {
+		t.Fatalf("%d live and %d stored windows, expected 4 or 5.\n", len(windows), len(stored))
+	}
+	var sent, completed uint64
+	for i, window := range windows {
+		t.Logf("Window %d: %+v\n", i, *window)
+		if window.Start != stored[i].Start || window.Completed != stored[i].Completed {
+			t.Fatalf("Live window %d differs from the stored one.\n", i)
+		}
+		if i < 4 && (window.Sent < 45 || window.Sent > 55 || window.Latency.P50 < time.Millisecond) {
+			t.Fatalf("Unexpected window %d: %+v.\n", i, *window)
+		}
+		if window.Failed != 0 || window.Succeeded != window.Completed {
+			t.Fatalf("Unexpected failures in window %d: %+v.\n", i, *window)
+		}
+		sent += window.Sent
+		completed += window.Completed
+	}
+	if sent != gen.CallCount() || completed != uint64(results) {
+		t.Fatalf("Windows count %d sent and %d completed, expected %d and %d.\n", sent, completed, gen.CallCount(), results)
+	}
+	if len(gen.Report().TimeSeries) != len(windows) {
+		t.Fatalf("Time series missing from the report.\n")
+	}
+	// WindowChan is closed with the run, the generator can't be restarted.
+	if gen.Start() {
+		t.Fatalf("Restart of a stopped generator accepted.\n")
+	}
+	if len(gen.TimeSeries()) != len(windows) {
+		t.Fatalf("Refused restart changed the time series: %d windows, expected %d.\n", len(gen.TimeSeries()), len(windows))
+	}
+}
+
+func TestTimeSeriesWarmUpPaused(t *testing.T) {
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{delay: time.Millisecond},
+		TimeoutNS:            50 * time.Millisecond,
+		PPS:                  uint64(200),
+		ProcessingDurationNS: 600 * time.Millisecond,
+		WarmUpDurationNS:     300 * time.Millisecond,
+		WindowNS:             100 * time.Millisecond,
+		ResultChan:           make(chan *lib.CallResult, 200),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	gen.Start()
+	resumed := make(chan time.Time, 1)
+	time.AfterFunc(50*time.Millisecond, func() {
+		gen.Pause()
+		time.Sleep(400 * time.Millisecond)
+		resumed <- time.Now()
+		gen.Resume()
+	})
+	for range pset.ResultChan {
+	}
+	resumedAt := <-resumed
+
+	// Less than 300ms of active time passed before the resume.
+	measured := 0
+	for i, window := range gen.TimeSeries() {
+		if window.Start.Before(resumedAt) && !window.WarmUp {
+			t.Fatalf("Window %d starting at %v before the resume at %v isn't warm-up.\n", i, window.Start, resumedAt)
+		}
+		if !window.WarmUp {
+			measured++
+		}
+	}
+	if measured == 0 {
+		t.Fatalf("Every window was counted as warm-up.\n")
+	}
+}
+
+func TestResultSink(t *testing.T) {
+	resultChan := make(chan *lib.CallResult, 200)
+	aggregator := lib.NewAggregator()
+	var events int64
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{delay: time.Millisecond},
+		TimeoutNS:            50 * time.Millisecond,
+		PPS:                  uint64(200),
+		ProcessingDurationNS: 500 * time.Millisecond,
+		ResultSink: lib.NewFanOutSink(lib.NewChannelSink(resultChan), aggregator, lib.NewFuncSink(func(result *lib.CallResult) {
+			if result.IsEvent() {
+				atomic.AddInt64(&events, 1)
+			}
+		})),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	gen.Start()
+	time.AfterFunc(100*time.Millisecond, func() { gen.SetPPS(100) })
+	count := 0
+	for r := range resultChan {
+		if !r.IsEvent() {
+			count++
+		}
+	}
+	if uint64(count) != aggregator.Count() || uint64(count) != gen.CallCount() || atomic.LoadInt64(&events) != 1 {
+		t.Fatalf("Channel got %d results, aggregator %d and callback %d events of %d calls.\n", count, aggregator.Count(), atomic.LoadInt64(&events), gen.CallCount())
+	}
+
+	pset.ResultChan = resultChan
+	if _, err := NewLoadGenerator(pset); err == nil {
+		t.Fatalf("Accepted both resultChan and resultSink.\n")
+	}
+}
+
+func TestLosslessDelivery(t *testing.T) {
+	for _, delivery := range []DeliveryMode{DELIVERY_BLOCK, DELIVERY_SPILL} {
+		pset := NewLoadGeneratorParams{
+			Caller:               &sleepCaller{delay: time.Millisecond},
+			TimeoutNS:            50 * time.Millisecond,
+			PPS:                  uint64(500),
+			ProcessingDurationNS: 500 * time.Millisecond,
+			StopGracePeriodNS:    time.Second,
+			Delivery:             delivery,
+			ResultChan:           make(chan *lib.CallResult, 5),
+		}
+		gen, err := NewLoadGenerator(pset)
+		if err != nil {
+			t.Fatalf("Load generator initialization failing: %s\n",
+				err)
+			t.FailNow()
+		}
+
+		gen.Start()
+		// The consumer takes twice as long as the run to read everything.
+		count := 0
+		for range pset.ResultChan {
+			count++
+			time.Sleep(4 * time.Millisecond)
+		}
+		report := gen.Report()
+		t.Logf("Delivery %d: %d results of %d calls, %d ignored, %d spilled, %d abandoned.\n", delivery, count, report.Calls, report.Ignored, report.Spilled, report.Abandoned)
+		if report.Ignored != 0 || uint64(count) != report.Calls {
+			t.Fatalf("Delivery %d lost results: %d of %d calls delivered, %d ignored.\n", delivery, count, report.Calls, report.Ignored)
+		}
+		if delivery == DELIVERY_SPILL && (report.Spilled == 0 || report.Calls < 245) {
+			t.Fatalf("Spilling slowed the run down or didn't spill: %d calls, %d spilled.\n", report.Calls, report.Spilled)
+		}
+	}
+}
+
+func TestBlockingDeliveryStop(t *testing.T) {
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{delay: time.Millisecond},
+		TimeoutNS:            50 * time.Millisecond,
+		PPS:                  uint64(500),
+		ProcessingDurationNS: 2 * time.Second,
+		StopGracePeriodNS:    100 * time.Millisecond,
+		Delivery:             DELIVERY_BLOCK,
+		ResultChan:           make(chan *lib.CallResult, 5),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	gen.Start()
+	// The slow consumer stops the run from its read loop and reads nothing until Stop returns.
+	count := 0
+	for range pset.ResultChan {
+		count++
+		time.Sleep(10 * time.Millisecond)
+		if count == 20 {
+			stopped := make(chan bool)
+			go func() {
+				stopped <- gen.Stop()
+			}()
+			select {
+			case <-stopped:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Stop from the consumer didn't return.\n")
+			}
+		}
+	}
+	report := gen.Report()
+	t.Logf("%d results of %d calls, %d ignored.\n", count, report.Calls, report.Ignored)
+	if report.Ignored == 0 || uint64(count)+report.Ignored != report.Calls {
+		t.Fatalf("%d delivered and %d ignored of %d calls.\n", count, report.Ignored, report.Calls)
+	}
+}
+
+func TestReportCSV(t *testing.T) {
+	pset := NewLoadGeneratorParams{
+		Caller:               &sleepCaller{delay: time.Millisecond},
+		TimeoutNS:            50 * time.Millisecond,
+		PPS:                  uint64(100),
+		ProcessingDurationNS: 500 * time.Millisecond,
+		WindowNS:             100 * time.Millisecond,
+		ResultChan:           make(chan *lib.CallResult, 100),
+	}
+	gen, err := NewLoadGenerator(pset)
+	if err != nil {
+		t.Fatalf("Load generator initialization failing: %s\n",
+			err)
+		t.FailNow()
+	}
+
+	gen.Start()
+	for range pset.ResultChan {
+	}
+	report := gen.Report()
+
+	var summary, timeSeries bytes.Buffer
+	if err := report.WriteSummaryCSV(&summary); err != nil {
+		t.Fatalf("Summary export failing: %s\n", err)
+	}
+	if err := report.WriteTimeSeriesCSV(&timeSeries); err != nil {
+		t.Fatalf("Time series export failing: %s\n", err)
+	}
+	t.Logf("Summary:\n%s\nTime series:\n%s", summary.String(), timeSeries.String())
+
+	rows, err := csv.NewReader(&summary).ReadAll()
+	if err != nil || len(rows) != 3 || len(rows[0]) != len(SUMMARY_CSV_HEADER) {
+		t.Fatalf("Unexpected summary rows %v (%v).\n", rows, err)
+	}
+	if rows[1][0] != "all" || rows[2][2] != "Success" || rows[1][3] != rows[2][3] || rows[1][3] != fmt.Sprint(report.Latency.Count) {
+		t.Fatalf("Unexpected summary rows %v.\n", rows)
+	}
+	rows, err = csv.NewReader(&timeSeries).ReadAll()
+	if err != nil || len(rows) != len(report.TimeSeries)+1 || len(rows[1]) != len(lib.TIME_SERIES_CSV_HEADER) {
+		t.Fatalf("Unexpected time series rows %v (%v).\n", rows, err)
+	}
+}
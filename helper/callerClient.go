@@ -3,6 +3,7 @@ package helper
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"load-generator/lib"
@@ -64,17 +65,40 @@ func (receiver *tcpCallerClient) BuildReq() lib.RawRequest {
 }
 
 func (receiver *tcpCallerClient) Call(req []byte, timeoutNS time.Duration) ([]byte, error) {
-	conn, err := net.DialTimeout("tcp", receiver.addr, timeoutNS)
+	ctx, cancel := context.WithTimeout(context.Background(), timeoutNS)
+	defer cancel()
+	return receiver.CallContext(ctx, req)
+}
+
+func (receiver *tcpCallerClient) CallContext(ctx context.Context, req []byte) ([]byte, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", receiver.addr)
 	if err != nil {
 		return nil, err
 	}
+	defer conn.Close()
+
+	// Closing the connection unblocks Write and Read once ctx is done.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
 
 	_, err = Write(conn, req, DELIM)
 	if err != nil {
 		return nil, err
 	}
 
-	return Read(conn, DELIM)
+	resp, err := Read(conn, DELIM)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return resp, err
 }
 
 func (receiver *tcpCallerClient) CheckResp(req lib.RawRequest, resp lib.RawResponse) *lib.CallResult {
@@ -0,0 +1,606 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"load-generator/lib"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// HTML_REPORT_BARS is the number of bars of the latency histogram.
+	HTML_REPORT_BARS = 40
+
+	chartWidth   = 880
+	chartHeight  = 260
+	chartLeft    = 72
+	chartRight   = 16
+	chartTop     = 12
+	chartBottom  = 32
+	chartYTicks  = 5
+	chartXTicks  = 8
+	chartSamples = 1000
+)
+
+// RunConfig is the part of NewLoadGeneratorParams that describes the load of a
+// run. WriteRunConfig stores it as JSON next to the results file, so the HTML
+// report shows how the run was configured.
+type RunConfig struct {
+	Mode                  string
+	Arrival               string
+	PPS                   uint64
+	ProcessingDurationNS  time.Duration
+	TimeoutNS             time.Duration
+	Stages                []Stage
+	Shape                 *Shape
+	Spikes                []Spike
+	VirtualUsers          uint64
+	ThinkTimeNS           time.Duration
+	ReplaySpeed           float64
+	SchedulerTickNS       time.Duration
+	SchedulerBurst        uint64
+	StopGracePeriodNS     time.Duration
+	TotalRequests         uint64
+	WarmUpDurationNS      time.Duration
+	MaxInFlight           uint64
+	Backpressure          BackpressurePolicy
+	BackpressureQueueSize uint64
+	Delivery              DeliveryMode
+	WindowNS              time.Duration
+}
+
+func NewRunConfig(params NewLoadGeneratorParams) RunConfig {
+	config := RunConfig{
+		Mode:                  "open-loop",
+		PPS:                   params.PPS,
+		ProcessingDurationNS:  params.ProcessingDurationNS,
+		TimeoutNS:             params.TimeoutNS,
+		Stages:                append([]Stage(nil), params.Stages...),
+		Spikes:                append([]Spike(nil), params.Spikes...),
+		VirtualUsers:          params.VirtualUsers,
+		ThinkTimeNS:           params.ThinkTimeNS,
+		SchedulerTickNS:       params.SchedulerTickNS,
+		SchedulerBurst:        params.SchedulerBurst,
+		StopGracePeriodNS:     params.StopGracePeriodNS,
+		TotalRequests:         params.TotalRequests,
+		WarmUpDurationNS:      params.WarmUpDurationNS,
+		MaxInFlight:           params.MaxInFlight,
+		Backpressure:          params.Backpressure,
+		BackpressureQueueSize: params.BackpressureQueueSize,
+		Delivery:              params.Delivery,
+		WindowNS:              params.WindowNS,
+	}
+	if params.Shape != nil {
+		config.Shape = params.Shape.clone()
+	}
+	switch {
+	case params.VirtualUsers > 0:
+		config.Mode = "closed-loop"
+		config.Arrival = closedLoopArrivalName(params.VirtualUsers, params.ThinkTimeNS)
+	case params.Trace != nil:
+		config.Mode = "replay"
+		config.ReplaySpeed = params.ReplaySpeed
+		if config.ReplaySpeed == 0 {
+			config.ReplaySpeed = 1
+		}
+		config.Arrival = replayArrivalName(config.ReplaySpeed)
+	case params.Arrival != nil:
+		config.Arrival = params.Arrival.Name()
+	default:
+		config.Arrival = lib.NewConstantArrival().Name()
+	}
+	return config
+}
+
+// WriteRunConfig stores config as JSON, to be handed to the HTML report with
+// the results file of the run.
+func WriteRunConfig(writer io.Writer, config RunConfig) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(append(data, '\n'))
+	return err
+}
+
+// ReadRunConfig reads a config stored by WriteRunConfig.
+func ReadRunConfig(reader io.Reader) (*RunConfig, error) {
+	config := &RunConfig{}
+	if err := json.NewDecoder(reader).Decode(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+type HTMLReportParams struct {
+	Title string
+	// Results is read to the end as JSON Lines, see lib.NewJSONLinesSink.
+	Results io.Reader
+	// Config is shown as the run configuration, the section is left out when nil.
+	Config *RunConfig
+	// WindowNS is the interval of the charts over time, defaults to DEFAULT_WINDOW.
+	WindowNS time.Duration
+}
+
+// WriteHTMLReport turns a results file into a single HTML page. The charts are
+// inline SVG and the styles are inline too, so the page works offline.
+// Latency is the service time; the summary, the histogram and the breakdown
+// by RetCode leave out the warm-up, the charts over time don't.
+func WriteHTMLReport(writer io.Writer, params HTMLReportParams) error {
+	if params.Results == nil {
+		return errors.New("Invalid results!")
+	}
+	if params.WindowNS < 0 {
+		return errors.New("Invalid windowNS!")
+	}
+	if params.WindowNS == 0 {
+		params.WindowNS = DEFAULT_WINDOW
+	}
+	if params.Title == "" {
+		params.Title = "Load generator report"
+	}
+	data, err := analyzeResults(params.Results, params.WindowNS)
+	if err != nil {
+		return err
+	}
+	data.Title = params.Title
+	data.GeneratedAt = time.Now().Format(time.RFC3339)
+	if params.Config != nil {
+		data.Config = configRows(*params.Config)
+	}
+	return htmlReportTemplate.Execute(writer, data)
+}
+
+type htmlReportData struct {
+	Title       string
+	GeneratedAt string
+	Config      [][2]string
+	Started     string
+	Duration    time.Duration
+	Results     uint64
+	Calls       uint64
+	WarmUp      uint64
+	Truncated   bool
+	AchievedPPS float64
+	Latency     lib.LatencySummary
+	Codes       []htmlReportCode
+	Events      []htmlReportEvent
+	Throughput  template.HTML
+	Percentiles template.HTML
+	Histogram   template.HTML
+}
+
+type htmlReportCode struct {
+	Code    lib.RetCode
+	Label   string
+	Count   uint64
+	Share   float64
+	Latency lib.LatencySummary
+}
+
+type htmlReportEvent struct {
+	Offset time.Duration
+	Name   string
+	Detail string
+}
+
+// analyzeResults reads the results in one pass. Windows are cut by the
+// completion time of the calls, in the order the results were delivered,
+// starting from the first result. A call delivered later may have started
+// earlier, so offsets are taken from the earliest start, found at the end.
+func analyzeResults(results io.Reader, windowNS time.Duration) (*htmlReportData, error) {
+	data := &htmlReportData{}
+	reader := lib.NewJSONLinesReader(results)
+	aggregator := lib.NewAggregator()
+	var recorder *lib.WindowRecorder
+	var windows []*lib.TimeWindow
+	var events []*lib.CallResult
+	sent := map[int]uint64{}
+	var anchor, origin, windowEnd, end, measuredFrom time.Time
+	for {
+		result, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data.Results++
+		startedAt := resultTime(result)
+		if recorder == nil {
+			anchor = startedAt
+			windowEnd = anchor.Add(windowNS)
+			recorder = lib.NewWindowRecorder(anchor)
+		}
+		if origin.IsZero() || startedAt.Before(origin) {
+			origin = startedAt
+		}
+		if result.IsEvent() {
+			events = append(events, result)
+			continue
+		}
+		done := startedAt.Add(result.Elapse)
+		if done.After(end) {
+			end = done
+		}
+		for !done.Before(windowEnd) {
+			windows = append(windows, recorder.Rotate(windowEnd))
+			windowEnd = windowEnd.Add(windowNS)
+		}
+		recorder.Add(result)
+		if index := int(startedAt.Sub(anchor) / windowNS); index > 0 {
+			sent[index]++
+		} else {
+			sent[0]++
+		}
+		if !aggregator.Add(result) {
+			data.WarmUp++
+			continue
+		}
+		if measuredFrom.IsZero() || startedAt.Before(measuredFrom) {
+			measuredFrom = startedAt
+		}
+	}
+	for _, event := range events {
+		data.Events = append(data.Events, newHTMLReportEvent(event, origin))
+	}
+	data.Truncated = reader.Truncated()
+	if end.IsZero() {
+		return data, nil
+	}
+	if end.After(windowEnd.Add(-windowNS)) {
+		windows = append(windows, recorder.Rotate(end))
+	}
+	for i, window := range windows {
+		window.Sent = sent[i]
+	}
+
+	data.Started = origin.Format(time.RFC3339Nano)
+	data.Duration = end.Sub(origin)
+	data.Calls = aggregator.Count()
+	data.Latency = aggregator.All()
+	if measured := end.Sub(measuredFrom); data.Calls > 0 && measured > 0 {
+		data.AchievedPPS = float64(aggregator.Success().Count) / measured.Seconds()
+	}
+	for _, code := range aggregator.Codes() {
+		latency := aggregator.ByCode(code)
+		data.Codes = append(data.Codes, htmlReportCode{
+			Code:    code,
+			Label:   lib.GetRetCodePlain(code),
+			Count:   latency.Count,
+			Share:   100 * float64(latency.Count) / float64(data.Calls),
+			Latency: latency,
+		})
+	}
+	data.Throughput, data.Percentiles = timeSeriesCharts(windows, origin)
+	data.Histogram = histogramChart(aggregator.Bars(HTML_REPORT_BARS))
+	return data, nil
+}
+
+// resultTime is when the call started, or when the event happened.
+func resultTime(result *lib.CallResult) time.Time {
+	switch {
+	case result.IsEvent() && result.Event != nil:
+		return result.Event.Time
+	case !result.StartedAt.IsZero():
+		return result.StartedAt
+	default:
+		return result.ScheduledAt
+	}
+}
+
+func newHTMLReportEvent(result *lib.CallResult, origin time.Time) htmlReportEvent {
+	event := htmlReportEvent{Offset: resultTime(result).Sub(origin).Round(time.Millisecond), Name: result.Msg}
+	if result.Event == nil {
+		return event
+	}
+	event.Name = lib.GetEventTypePlain(result.Event.Type)
+	switch result.Event.Type {
+	case lib.EVENT_RATE_CHANGED:
+		event.Detail = fmt.Sprintf("%d pps", result.Event.PPS)
+	case lib.EVENT_TIMEOUT_CHANGED:
+		event.Detail = result.Event.TimeoutNS.String()
+	case lib.EVENT_SPIKE_STARTED, lib.EVENT_SPIKE_ENDED:
+		event.Detail = fmt.Sprintf("spike %d", result.Event.Spike)
+	}
+	return event
+}
+
+var (
+	backpressureNames = map[BackpressurePolicy]string{BACKPRESSURE_BLOCK: "block", BACKPRESSURE_DROP: "drop", BACKPRESSURE_QUEUE: "queue"}
+	deliveryNames     = map[DeliveryMode]string{DELIVERY_BEST_EFFORT: "best effort", DELIVERY_BLOCK: "block", DELIVERY_SPILL: "spill"}
+	shapeNames        = map[ShapeKind]string{SHAPE_SINE: "sine", SHAPE_SQUARE: "square", SHAPE_DAILY: "daily"}
+)
+
+// configRows lists the settings of the run that were set, in the order of NewLoadGeneratorParams.
+func configRows(config RunConfig) [][2]string {
+	var rows [][2]string
+	add := func(name string, set bool, format string, values ...interface{}) {
+		if set {
+			rows = append(rows, [2]string{name, fmt.Sprintf(format, values...)})
+		}
+	}
+	add("Mode", true, "%s", config.Mode)
+	add("Arrival", config.Arrival != "", "%s", config.Arrival)
+	add("PPS", config.PPS > 0, "%d", config.PPS)
+	add("Processing duration", config.ProcessingDurationNS > 0, "%v", config.ProcessingDurationNS)
+	add("Timeout", true, "%v", config.TimeoutNS)
+	for i, stage := range config.Stages {
+		transition := "step"
+		if stage.Transition == STAGE_TRANSITION_LINEAR {
+			transition = "linear"
+		}
+		add(fmt.Sprintf("Stage %d", i), true, "%d pps for %v, %s", stage.PPS, stage.DurationNS, transition)
+	}
+	if shape := config.Shape; shape != nil {
+		add("Shape", true, "%s %d-%d pps, period %v", shapeNames[shape.Kind], shape.MinPPS, shape.MaxPPS, shape.PeriodNS)
+	}
+	for i, spike := range config.Spikes {
+		add(fmt.Sprintf("Spike %d", i+1), true, "x%g at %v for %v, burst %d", spike.Factor, spike.AtNS, spike.DurationNS, spike.Burst)
+	}
+	add("Virtual users", config.VirtualUsers > 0, "%d", config.VirtualUsers)
+	add("Think time", config.ThinkTimeNS > 0, "%v", config.ThinkTimeNS)
+	add("Replay speed", config.ReplaySpeed > 0, "%g", config.ReplaySpeed)
+	add("Scheduler tick", config.SchedulerTickNS > 0, "%v", config.SchedulerTickNS)
+	add("Scheduler burst", config.SchedulerBurst > 0, "%d", config.SchedulerBurst)
+	add("Stop grace period", config.StopGracePeriodNS > 0, "%v", config.StopGracePeriodNS)
+	add("Total requests", config.TotalRequests > 0, "%d", config.TotalRequests)
+	add("Warm-up", config.WarmUpDurationNS > 0, "%v", config.WarmUpDurationNS)
+	add("Max in flight", config.MaxInFlight > 0, "%d", config.MaxInFlight)
+	add("Backpressure", true, "%s", backpressureNames[config.Backpressure])
+	add("Backpressure queue size", config.BackpressureQueueSize > 0, "%d", config.BackpressureQueueSize)
+	add("Delivery", true, "%s", deliveryNames[config.Delivery])
+	add("Window", config.WindowNS > 0, "%v", config.WindowNS)
+	return rows
+}
+
+type chartSeries struct {
+	Name   string
+	Color  string
+	Values []float64
+}
+
+func timeSeriesCharts(windows []*lib.TimeWindow, origin time.Time) (template.HTML, template.HTML) {
+	xs := make([]float64, len(windows))
+	sent := chartSeries{Name: "sent/s", Color: "#9e9e9e"}
+	completed := chartSeries{Name: "completed/s", Color: "#1e88e5"}
+	succeeded := chartSeries{Name: "succeeded/s", Color: "#43a047"}
+	failed := chartSeries{Name: "failed/s", Color: "#e53935"}
+	p50 := chartSeries{Name: "p50", Color: "#43a047"}
+	p90 := chartSeries{Name: "p90", Color: "#1e88e5"}
+	p99 := chartSeries{Name: "p99", Color: "#fb8c00"}
+	max := chartSeries{Name: "max", Color: "#e53935"}
+	for i, window := range windows {
+		xs[i] = window.Start.Add(window.Length).Sub(origin).Seconds()
+		seconds := window.Length.Seconds()
+		if seconds <= 0 {
+			seconds = math.SmallestNonzeroFloat64
+		}
+		sent.Values = append(sent.Values, float64(window.Sent)/seconds)
+		completed.Values = append(completed.Values, float64(window.Completed)/seconds)
+		succeeded.Values = append(succeeded.Values, float64(window.Succeeded)/seconds)
+		failed.Values = append(failed.Values, float64(window.Failed)/seconds)
+		p50.Values = append(p50.Values, milliseconds(window.Latency.P50))
+		p90.Values = append(p90.Values, milliseconds(window.Latency.P90))
+		p99.Values = append(p99.Values, milliseconds(window.Latency.P99))
+		max.Values = append(max.Values, milliseconds(window.Latency.Max))
+	}
+	throughput := lineChart(xs, []chartSeries{sent, completed, succeeded, failed}, "")
+	percentiles := lineChart(xs, []chartSeries{p50, p90, p99, max}, " ms")
+	return throughput, percentiles
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
+
+// lineChart draws the series against xs, seconds since the start of the run, as inline SVG.
+func lineChart(xs []float64, series []chartSeries, unit string) template.HTML {
+	if len(xs) == 0 {
+		return template.HTML(`<p class="empty">No results.</p>`)
+	}
+	maxX := xs[len(xs)-1]
+	if maxX <= 0 {
+		maxX = 1
+	}
+	var maxY float64
+	for _, s := range series {
+		for _, value := range s.Values {
+			maxY = math.Max(maxY, value)
+		}
+	}
+	maxY = niceCeil(maxY)
+	plotWidth := float64(chartWidth - chartLeft - chartRight)
+	plotHeight := float64(chartHeight - chartTop - chartBottom)
+	x := func(value float64) float64 { return chartLeft + value/maxX*plotWidth }
+	y := func(value float64) float64 { return chartTop + plotHeight - value/maxY*plotHeight }
+
+	var svg strings.Builder
+	openChart(&svg, "line chart")
+	for i := 0; i <= chartYTicks; i++ {
+		value := maxY * float64(i) / chartYTicks
+		fmt.Fprintf(&svg, `<line class="grid" x1="%d" y1="%.1f" x2="%d" y2="%.1f"/>`, chartLeft, y(value), chartWidth-chartRight, y(value))
+		fmt.Fprintf(&svg, `<text x="%d" y="%.1f" text-anchor="end">%s%s</text>`, chartLeft-6, y(value)+4, formatTick(value), template.HTMLEscapeString(unit))
+	}
+	for i := 0; i <= chartXTicks; i++ {
+		value := maxX * float64(i) / chartXTicks
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%d" text-anchor="middle">%ss</text>`, x(value), chartHeight-10, formatTick(value))
+	}
+	// Long runs are thinned out to keep the page small, peaks included.
+	step := (len(xs) + chartSamples - 1) / chartSamples
+	for _, s := range series {
+		fmt.Fprintf(&svg, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="`, s.Color)
+		for i := 0; i < len(xs); i += step {
+			value := s.Values[i]
+			for j := i + 1; j < i+step && j < len(xs); j++ {
+				value = math.Max(value, s.Values[j])
+			}
+			fmt.Fprintf(&svg, "%.1f,%.1f ", x(xs[i]), y(value))
+		}
+		svg.WriteString(`"/>`)
+	}
+	svg.WriteString(`</svg>`)
+	svg.WriteString(`<div class="legend">`)
+	for _, s := range series {
+		fmt.Fprintf(&svg, `<span><i style="background:%s"></i>%s</span>`, s.Color, template.HTMLEscapeString(s.Name))
+	}
+	svg.WriteString(`</div>`)
+	return template.HTML(svg.String())
+}
+
+// histogramChart draws the bars of the latency distribution, on a log scale of latency.
+func histogramChart(bars []lib.HistogramBar) template.HTML {
+	if len(bars) == 0 {
+		return template.HTML(`<p class="empty">No results.</p>`)
+	}
+	var maxCount uint64
+	for _, bar := range bars {
+		if bar.Count > maxCount {
+			maxCount = bar.Count
+		}
+	}
+	maxY := niceCeil(float64(maxCount))
+	plotWidth := float64(chartWidth - chartLeft - chartRight)
+	plotHeight := float64(chartHeight - chartTop - chartBottom)
+	barWidth := plotWidth / float64(len(bars))
+
+	var svg strings.Builder
+	openChart(&svg, "latency histogram")
+	for i := 0; i <= chartYTicks; i++ {
+		value := maxY * float64(i) / chartYTicks
+		top := chartTop + plotHeight - value/maxY*plotHeight
+		fmt.Fprintf(&svg, `<line class="grid" x1="%d" y1="%.1f" x2="%d" y2="%.1f"/>`, chartLeft, top, chartWidth-chartRight, top)
+		fmt.Fprintf(&svg, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`, chartLeft-6, top+4, formatTick(value))
+	}
+	labelEvery := (len(bars) + chartXTicks - 1) / chartXTicks
+	for i, bar := range bars {
+		height := float64(bar.Count) / maxY * plotHeight
+		left := chartLeft + float64(i)*barWidth
+		fmt.Fprintf(&svg, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="#1e88e5"><title>%v - %v: %d</title></rect>`,
+			left+1, chartTop+plotHeight-height, math.Max(barWidth-2, 1), height, roundDuration(bar.From), roundDuration(bar.To), bar.Count)
+		if i%labelEvery == 0 {
+			fmt.Fprintf(&svg, `<text x="%.1f" y="%d" text-anchor="start">%v</text>`, left, chartHeight-10, roundDuration(bar.From))
+		}
+	}
+	svg.WriteString(`</svg>`)
+	return template.HTML(svg.String())
+}
+
+func openChart(svg *strings.Builder, label string) {
+	fmt.Fprintf(svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" role="img" aria-label="%s">`, chartWidth, chartHeight, label)
+	fmt.Fprintf(svg, `<line class="axis" x1="%d" y1="%d" x2="%d" y2="%d"/>`, chartLeft, chartTop, chartLeft, chartHeight-chartBottom)
+	fmt.Fprintf(svg, `<line class="axis" x1="%d" y1="%d" x2="%d" y2="%d"/>`, chartLeft, chartHeight-chartBottom, chartWidth-chartRight, chartHeight-chartBottom)
+}
+
+// niceCeil rounds value up to 1, 2 or 5 times a power of ten, at least 1.
+func niceCeil(value float64) float64 {
+	if value <= 1 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(value)))
+	for _, factor := range []float64{1, 2, 5, 10} {
+		if value <= factor*magnitude {
+			return factor * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func formatTick(value float64) string {
+	return strings.TrimSuffix(fmt.Sprintf("%.4g", value), ".0")
+}
+
+func roundDuration(duration time.Duration) time.Duration {
+	switch {
+	case duration >= time.Second:
+		return duration.Round(time.Millisecond)
+	case duration >= time.Millisecond:
+		return duration.Round(10 * time.Microsecond)
+	case duration >= time.Microsecond:
+		return duration.Round(10 * time.Nanosecond)
+	default:
+		return duration
+	}
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #212121; margin: 24px auto; max-width: 920px; padding: 0 16px; }
+h1 { font-size: 22px; margin-bottom: 4px; }
+h2 { font-size: 17px; margin-top: 32px; border-bottom: 1px solid #e0e0e0; padding-bottom: 4px; }
+.meta, .empty { color: #757575; font-size: 13px; }
+.warning { background: #fff3e0; border-left: 4px solid #fb8c00; padding: 8px 12px; }
+table { border-collapse: collapse; font-size: 13px; width: 100%; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #eeeeee; }
+td.num, th.num { text-align: right; font-variant-numeric: tabular-nums; }
+.tiles { display: flex; flex-wrap: wrap; gap: 12px; }
+.tile { border: 1px solid #e0e0e0; border-radius: 4px; padding: 8px 12px; min-width: 120px; }
+.tile b { display: block; font-size: 18px; }
+.tile span { color: #757575; font-size: 12px; }
+svg { width: 100%; height: auto; font-size: 11px; fill: #616161; }
+svg .grid { stroke: #eeeeee; }
+svg .axis { stroke: #9e9e9e; }
+.legend { font-size: 12px; margin-top: 4px; }
+.legend span { margin-right: 16px; }
+.legend i { display: inline-block; width: 10px; height: 10px; margin-right: 4px; }
+.bar { background: #e53935; height: 10px; }
+.bar.success { background: #43a047; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">Generated {{.GeneratedAt}}{{if .Started}}, run started {{.Started}}{{end}}</p>
+{{if .Truncated}}<p class="warning">The results file ends with a truncated line, it was left out.</p>{{end}}
+
+<h2>Summary</h2>
+<div class="tiles">
+<div class="tile"><b>{{.Calls}}</b><span>calls</span></div>
+<div class="tile"><b>{{printf "%.2f" .AchievedPPS}}</b><span>successful pps</span></div>
+<div class="tile"><b>{{.Duration}}</b><span>duration</span></div>
+<div class="tile"><b>{{.Latency.P50}}</b><span>p50</span></div>
+<div class="tile"><b>{{.Latency.P99}}</b><span>p99</span></div>
+<div class="tile"><b>{{.Latency.Max}}</b><span>max</span></div>
+</div>
+<p class="meta">{{.Results}} results read, {{.WarmUp}} warm-up calls and {{len .Events}} events left out of the summary.</p>
+
+<h2>Throughput over time</h2>
+{{.Throughput}}
+
+<h2>Latency percentiles over time</h2>
+{{.Percentiles}}
+
+<h2>Latency histogram</h2>
+{{.Histogram}}
+{{if .Calls}}<table>
+<tr><th class="num">min</th><th class="num">mean</th><th class="num">stddev</th><th class="num">p50</th><th class="num">p90</th><th class="num">p99</th><th class="num">p99.9</th><th class="num">p99.99</th><th class="num">max</th></tr>
+<tr><td class="num">{{.Latency.Min}}</td><td class="num">{{.Latency.Mean}}</td><td class="num">{{.Latency.StdDev}}</td><td class="num">{{.Latency.P50}}</td><td class="num">{{.Latency.P90}}</td><td class="num">{{.Latency.P99}}</td><td class="num">{{.Latency.P999}}</td><td class="num">{{.Latency.P9999}}</td><td class="num">{{.Latency.Max}}</td></tr>
+</table>{{end}}
+
+<h2>Results by RetCode</h2>
+{{if .Codes}}<table>
+<tr><th>Code</th><th>Label</th><th class="num">Count</th><th class="num">Share</th><th style="width:30%"></th><th class="num">p50</th><th class="num">p99</th></tr>
+{{range .Codes}}<tr><td>{{.Code}}</td><td>{{.Label}}</td><td class="num">{{.Count}}</td><td class="num">{{printf "%.2f" .Share}}%</td><td><div class="bar{{if eq .Code 0}} success{{end}}" style="width:{{printf "%.2f" .Share}}%"></div></td><td class="num">{{.Latency.P50}}</td><td class="num">{{.Latency.P99}}</td></tr>
+{{end}}</table>{{else}}<p class="empty">No results.</p>{{end}}
+
+{{if .Events}}<h2>Events</h2>
+<table>
+<tr><th class="num">At</th><th>Event</th><th>Detail</th></tr>
+{{range .Events}}<tr><td class="num">+{{.Offset}}</td><td>{{.Name}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>{{end}}
+
+<h2>Run configuration</h2>
+{{if .Config}}<table>
+{{range .Config}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{end}}</table>{{else}}<p class="empty">Not recorded with the results.</p>{{end}}
+</body>
+</html>
+`))
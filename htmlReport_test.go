@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"load-generator/lib"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteHTMLReport(t *testing.T) {
+	var results bytes.Buffer
+	sink := lib.NewJSONLinesSink(&results, false)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	sink.Put(&lib.CallResult{Code: lib.RET_CODE_EVENT, Event: &lib.Event{Type: lib.EVENT_RATE_CHANGED, Time: start, PPS: 20}})
+	for i := 0; i < 60; i++ {
+		result := &lib.CallResult{
+			ID:        int64(i),
+			StartedAt: start.Add(time.Duration(i) * 50 * time.Millisecond),
+			Elapse:    time.Duration(i+1) * time.Millisecond,
+			WarmUp:    i < 10,
+		}
+		if i%10 == 9 {
+			result.Code = lib.RET_CODE_ERR_CALLEE
+		}
+		assert.True(t, sink.Put(result))
+	}
+	assert.Nil(t, sink.Close())
+
+	data, err := analyzeResults(bytes.NewReader(results.Bytes()), time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(61), data.Results)
+	assert.Equal(t, uint64(50), data.Calls)
+	assert.Equal(t, uint64(10), data.WarmUp)
+	assert.Equal(t, 1, len(data.Events))
+	assert.Equal(t, "20 pps", data.Events[0].Detail)
+	assert.Equal(t, 2, len(data.Codes))
+	assert.Equal(t, uint64(45), data.Codes[0].Count)
+	assert.Equal(t, lib.RET_CODE_ERR_CALLEE, data.Codes[1].Code)
+	assert.InDelta(t, 10.0, data.Codes[1].Share, 1e-9)
+	assert.Equal(t, 2950*time.Millisecond+60*time.Millisecond, data.Duration)
+
+	config := NewRunConfig(NewLoadGeneratorParams{PPS: 20, TimeoutNS: time.Second, WarmUpDurationNS: 500 * time.Millisecond, Spikes: []Spike{{AtNS: time.Second, DurationNS: time.Second, Factor: 2}}})
+	assert.Equal(t, "open-loop", config.Mode)
+	assert.Equal(t, lib.NewConstantArrival().Name(), config.Arrival)
+	var raw bytes.Buffer
+	assert.Nil(t, WriteRunConfig(&raw, config))
+	stored, err := ReadRunConfig(&raw)
+	assert.Nil(t, err)
+	assert.Equal(t, config, *stored)
+
+	var page bytes.Buffer
+	err = WriteHTMLReport(&page, HTMLReportParams{Title: "Checkout <staging>", Results: &results, Config: stored})
+	assert.Nil(t, err)
+	html := page.String()
+	assert.True(t, strings.HasPrefix(html, "<!DOCTYPE html>"))
+	assert.Contains(t, html, "Checkout &lt;staging&gt;")
+	assert.Equal(t, 3, strings.Count(html, "<svg "))
+	assert.Contains(t, html, "Callee Error")
+	assert.Contains(t, html, "Rate Changed")
+	assert.Contains(t, html, "x2 at 1s for 1s")
+	assert.Contains(t, html, "<th>Warm-up</th><td>500ms</td>")
+	// Everything is inline, so the page works offline.
+	assert.NotContains(t, html, "<script")
+	assert.NotContains(t, html, "<link")
+	assert.NotContains(t, html, "src=")
+
+	page.Reset()
+	assert.Nil(t, WriteHTMLReport(&page, HTMLReportParams{Results: strings.NewReader("")}))
+	assert.Contains(t, page.String(), "Not recorded with the results.")
+	assert.NotNil(t, WriteHTMLReport(&page, HTMLReportParams{}))
+}
+
+func TestHTMLReportOrigin(t *testing.T) {
+	var results bytes.Buffer
+	sink := lib.NewJSONLinesSink(&results, false)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Results are in completion order, the slow call started first but is delivered last.
+	sink.Put(&lib.CallResult{ID: 2, StartedAt: start.Add(100 * time.Millisecond), Elapse: 10 * time.Millisecond})
+	sink.Put(&lib.CallResult{Code: lib.RET_CODE_EVENT, Event: &lib.Event{Type: lib.EVENT_RATE_CHANGED, Time: start.Add(200 * time.Millisecond), PPS: 20}})
+	sink.Put(&lib.CallResult{ID: 1, StartedAt: start, Elapse: 500 * time.Millisecond})
+	assert.Nil(t, sink.Close())
+
+	data, err := analyzeResults(&results, 100*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, start.Format(time.RFC3339Nano), data.Started)
+	assert.Equal(t, 500*time.Millisecond, data.Duration)
+	assert.Equal(t, 200*time.Millisecond, data.Events[0].Offset)
+}
@@ -0,0 +1,140 @@
+package lib
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencySummary describes the distribution of the service time of a set of calls.
+type LatencySummary struct {
+	Count  uint64
+	Min    time.Duration
+	Max    time.Duration
+	Mean   time.Duration
+	StdDev time.Duration
+	P50    time.Duration
+	P75    time.Duration
+	P90    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+	P999   time.Duration
+	P9999  time.Duration
+	P99999 time.Duration
+}
+
+// Summarize returns the summary of the values recorded in histogram.
+func Summarize(histogram *Histogram) LatencySummary {
+	return LatencySummary{
+		Count:  histogram.Count(),
+		Min:    histogram.Min(),
+		Max:    histogram.Max(),
+		Mean:   histogram.Mean(),
+		StdDev: histogram.StdDev(),
+		P50:    histogram.ValueAtPercentile(50),
+		P75:    histogram.ValueAtPercentile(75),
+		P90:    histogram.ValueAtPercentile(90),
+		P95:    histogram.ValueAtPercentile(95),
+		P99:    histogram.ValueAtPercentile(99),
+		P999:   histogram.ValueAtPercentile(99.9),
+		P9999:  histogram.ValueAtPercentile(99.99),
+		P99999: histogram.ValueAtPercentile(99.999),
+	}
+}
+
+// Aggregator consumes call results and keeps a latency histogram of their
+// Elapse, over all calls and per RetCode. Events and warm-up results are
+// left out. It is safe for concurrent use.
+type Aggregator struct {
+	lock   sync.Mutex
+	all    *Histogram
+	byCode map[RetCode]*Histogram
+}
+
+func NewAggregator() *Aggregator {
+	return &Aggregator{all: NewHistogram(), byCode: map[RetCode]*Histogram{}}
+}
+
+// Put adds the result, so an Aggregator can be used as a ResultSink.
+func (receiver *Aggregator) Put(result *CallResult) bool {
+	receiver.Add(result)
+	return true
+}
+
+func (receiver *Aggregator) Close() error {
+	return nil
+}
+
+// Reset forgets every result counted so far.
+func (receiver *Aggregator) Reset() {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	receiver.all = NewHistogram()
+	receiver.byCode = map[RetCode]*Histogram{}
+}
+
+// Add records one result and reports whether it was counted.
+func (receiver *Aggregator) Add(result *CallResult) bool {
+	if result == nil || result.IsEvent() || result.WarmUp {
+		return false
+	}
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	histogram, ok := receiver.byCode[result.Code]
+	if !ok {
+		histogram = NewHistogram()
+		receiver.byCode[result.Code] = histogram
+	}
+	histogram.Record(result.Elapse)
+	receiver.all.Record(result.Elapse)
+	return true
+}
+
+// Count returns the number of results counted so far.
+func (receiver *Aggregator) Count() uint64 {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	return receiver.all.Count()
+}
+
+// All summarizes every call counted, whatever its RetCode.
+func (receiver *Aggregator) All() LatencySummary {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	return Summarize(receiver.all)
+}
+
+// Success summarizes the calls with RET_CODE_SUCCESS.
+func (receiver *Aggregator) Success() LatencySummary {
+	return receiver.ByCode(RET_CODE_SUCCESS)
+}
+
+// ByCode summarizes the calls with the given RetCode.
+func (receiver *Aggregator) ByCode(code RetCode) LatencySummary {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	histogram, ok := receiver.byCode[code]
+	if !ok {
+		return LatencySummary{}
+	}
+	return Summarize(histogram)
+}
+
+// Bars regroups the latency of every call counted into count bars, see Histogram.Bars.
+func (receiver *Aggregator) Bars(count int) []HistogramBar {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	return receiver.all.Bars(count)
+}
+
+// Codes returns the RetCodes seen so far, in ascending order.
+func (receiver *Aggregator) Codes() []RetCode {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	codes := make([]RetCode, 0, len(receiver.byCode))
+	for code := range receiver.byCode {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
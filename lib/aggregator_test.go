@@ -0,0 +1,42 @@
+package lib
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAggregator(t *testing.T) {
+	aggregator := NewAggregator()
+	for i := 1; i <= 100; i++ {
+		aggregator.Add(&CallResult{Code: RET_CODE_SUCCESS, Elapse: time.Duration(i) * time.Millisecond})
+	}
+	for i := 0; i < 10; i++ {
+		aggregator.Add(&CallResult{Code: RET_CODE_WARNING_TIMEOUT, Elapse: time.Second})
+	}
+	assert.False(t, aggregator.Add(&CallResult{Code: RET_CODE_EVENT, Event: &Event{Type: EVENT_RATE_CHANGED}}))
+	assert.False(t, aggregator.Add(&CallResult{Code: RET_CODE_SUCCESS, WarmUp: true, Elapse: time.Hour}))
+
+	assert.Equal(t, uint64(110), aggregator.Count())
+	assert.Equal(t, []RetCode{RET_CODE_SUCCESS, RET_CODE_WARNING_TIMEOUT}, aggregator.Codes())
+
+	success := aggregator.Success()
+	assert.Equal(t, uint64(100), success.Count)
+	assert.Equal(t, time.Millisecond, success.Min)
+	assert.Equal(t, 100*time.Millisecond, success.Max)
+	assert.InDelta(t, float64(50*time.Millisecond), float64(success.P50), float64(50*time.Microsecond))
+	assert.InDelta(t, float64(99*time.Millisecond), float64(success.P99), float64(99*time.Microsecond))
+
+	timeout := aggregator.ByCode(RET_CODE_WARNING_TIMEOUT)
+	assert.Equal(t, uint64(10), timeout.Count)
+	assert.Equal(t, time.Duration(0), timeout.StdDev)
+
+	all := aggregator.All()
+	assert.Equal(t, uint64(110), all.Count)
+	assert.Equal(t, time.Second, all.P99999)
+	assert.Equal(t, LatencySummary{}, aggregator.ByCode(RET_CODE_ERR_CALL))
+
+	aggregator.Reset()
+	assert.Equal(t, uint64(0), aggregator.Count())
+	assert.Empty(t, aggregator.Codes())
+}
@@ -0,0 +1,110 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ArrivalDistribution decides the gap between two consecutive payloads.
+// The mean gap is derived from the rate in effect when the gap starts and
+// passed in on every call, so a distribution that keeps to it only shapes the
+// traffic and never changes its mean rate.
+type ArrivalDistribution interface {
+	Name() string
+	NextInterval(mean time.Duration) time.Duration
+}
+
+type constantArrival struct{}
+
+func (receiver *constantArrival) Name() string {
+	return "constant"
+}
+
+func (receiver *constantArrival) NextInterval(mean time.Duration) time.Duration {
+	return mean
+}
+
+// NewConstantArrival returns the fixed-interval distribution, one payload every 1/PPS.
+func NewConstantArrival() ArrivalDistribution {
+	return &constantArrival{}
+}
+
+type poissonArrival struct {
+	lock sync.Mutex
+	rand *rand.Rand
+}
+
+func (receiver *poissonArrival) Name() string {
+	return "poisson"
+}
+
+func (receiver *poissonArrival) NextInterval(mean time.Duration) time.Duration {
+	receiver.lock.Lock()
+	factor := receiver.rand.ExpFloat64()
+	receiver.lock.Unlock()
+	return time.Duration(factor * float64(mean))
+}
+
+// NewPoissonArrival returns exponentially distributed inter-arrival times,
+// i.e. a Poisson arrival process with rate PPS.
+func NewPoissonArrival(seed int64) ArrivalDistribution {
+	return &poissonArrival{rand: rand.New(rand.NewSource(seed))}
+}
+
+type uniformArrival struct {
+	lock   sync.Mutex
+	rand   *rand.Rand
+	jitter float64
+}
+
+func (receiver *uniformArrival) Name() string {
+	return fmt.Sprintf("uniform(jitter=%.2f)", receiver.jitter)
+}
+
+func (receiver *uniformArrival) NextInterval(mean time.Duration) time.Duration {
+	receiver.lock.Lock()
+	factor := 1 + receiver.jitter*(2*receiver.rand.Float64()-1)
+	receiver.lock.Unlock()
+	return time.Duration(factor * float64(mean))
+}
+
+// NewUniformArrival returns intervals drawn uniformly from mean*(1-jitter) to mean*(1+jitter).
+func NewUniformArrival(jitter float64, seed int64) (ArrivalDistribution, error) {
+	if jitter < 0 || jitter > 1 {
+		errMsg := fmt.Sprintf("Invalid jitter %v, expected 0 <= jitter <= 1", jitter)
+		return nil, errors.New(errMsg)
+	}
+	return &uniformArrival{rand: rand.New(rand.NewSource(seed)), jitter: jitter}, nil
+}
+
+type customArrival struct {
+	name string
+	next func(mean time.Duration) time.Duration
+}
+
+func (receiver *customArrival) Name() string {
+	return receiver.name
+}
+
+func (receiver *customArrival) NextInterval(mean time.Duration) time.Duration {
+	interval := receiver.next(mean)
+	if interval < 0 {
+		return 0
+	}
+	return interval
+}
+
+// NewCustomArrival wraps a user-supplied distribution. next should keep the
+// long-run average of its return value equal to mean; negative values are treated as 0.
+func NewCustomArrival(name string, next func(mean time.Duration) time.Duration) (ArrivalDistribution, error) {
+	if name == "" {
+		return nil, errors.New("Invalid arrival name!")
+	}
+	if next == nil {
+		return nil, errors.New("Invalid arrival func!")
+	}
+	return &customArrival{name: name, next: next}, nil
+}
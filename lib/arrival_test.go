@@ -0,0 +1,52 @@
+package lib
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func meanInterval(arrival ArrivalDistribution, mean time.Duration, n int) time.Duration {
+	var sum time.Duration
+	for i := 0; i < n; i++ {
+		sum += arrival.NextInterval(mean)
+	}
+	return sum / time.Duration(n)
+}
+
+func TestConstantArrival(t *testing.T) {
+	arrival := NewConstantArrival()
+	assert.Equal(t, "constant", arrival.Name())
+	assert.Equal(t, time.Millisecond, arrival.NextInterval(time.Millisecond))
+}
+
+func TestPoissonArrival(t *testing.T) {
+	arrival := NewPoissonArrival(1)
+	assert.Equal(t, "poisson", arrival.Name())
+	assert.InDelta(t, float64(time.Millisecond), float64(meanInterval(arrival, time.Millisecond, 100000)), float64(20*time.Microsecond))
+}
+
+func TestUniformArrival(t *testing.T) {
+	_, err := NewUniformArrival(1.5, 1)
+	assert.NotNil(t, err)
+
+	arrival, err := NewUniformArrival(0.5, 1)
+	assert.Nil(t, err)
+	for i := 0; i < 1000; i++ {
+		interval := arrival.NextInterval(time.Millisecond)
+		assert.True(t, interval >= 500*time.Microsecond && interval <= 1500*time.Microsecond)
+	}
+	assert.InDelta(t, float64(time.Millisecond), float64(meanInterval(arrival, time.Millisecond, 100000)), float64(10*time.Microsecond))
+}
+
+func TestCustomArrival(t *testing.T) {
+	_, err := NewCustomArrival("", func(mean time.Duration) time.Duration { return mean })
+	assert.NotNil(t, err)
+	_, err = NewCustomArrival("broken", nil)
+	assert.NotNil(t, err)
+
+	arrival, err := NewCustomArrival("negative", func(mean time.Duration) time.Duration { return -mean })
+	assert.Nil(t, err)
+	assert.Equal(t, "negative", arrival.Name())
+	assert.Equal(t, time.Duration(0), arrival.NextInterval(time.Millisecond))
+}
@@ -11,15 +11,40 @@ const (
 	RET_CODE_ERR_RESPONSE    RetCode = 2002
 	RET_CODE_ERR_CALLEE      RetCode = 2003
 	RET_CODE_FATAL_CALL      RetCode = 3001
+	// RET_CODE_EVENT marks a generator event in the result stream, not a call.
+	RET_CODE_EVENT RetCode = 9001
 )
 
 type CallResult struct {
-	ID     int64
-	Req    RawRequest
-	Resp   RawResponse
-	Code   RetCode
-	Msg    string
+	ID   int64
+	Req  RawRequest
+	Resp RawResponse
+	Code RetCode
+	Msg  string
+	// Elapse is the service time, measured from the moment the call actually started.
 	Elapse time.Duration
+	// Arrival is the name of the arrival distribution that scheduled the call.
+	Arrival string
+	// Stage is the index of the load stage the call was issued in, 0 without stages.
+	Stage int
+	// Spike is the 1-based index of the spike the call was issued in, 0 outside spikes.
+	Spike int
+	// WarmUp marks calls issued during the warm-up period, which summaries leave out.
+	WarmUp bool
+	// ScheduledAt is the intended send time taken from the schedule, StartedAt
+	// the moment the call really started. They differ when the generator fell behind.
+	ScheduledAt time.Time
+	StartedAt   time.Time
+	// ResponseTime is measured from ScheduledAt, so it includes any time the
+	// payload spent waiting for a free goroutine (coordinated omission corrected).
+	ResponseTime time.Duration
+	// Event is set, and Code is RET_CODE_EVENT, when the entry is a generator event.
+	Event *Event
+}
+
+// IsEvent ...
+func (receiver *CallResult) IsEvent() bool {
+	return receiver.Code == RET_CODE_EVENT
 }
 
 // GetRetCodePlain ...
@@ -38,6 +63,8 @@ func GetRetCodePlain(code RetCode) string {
 		codePlain = "Callee Error"
 	case RET_CODE_FATAL_CALL:
 		codePlain = "Call Fatal Error"
+	case RET_CODE_EVENT:
+		codePlain = "Generator Event"
 	default:
 		codePlain = "Unknown result code"
 	}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"time"
 )
 
@@ -9,3 +10,38 @@ type Caller interface {
 	Call(req []byte, timeoutNS time.Duration) ([]byte, error)
 	CheckResp(req RawRequest, resp RawResponse) *CallResult
 }
+
+// ContextCaller is a Caller whose calls are bounded by a context. CallContext
+// should give up and return as soon as ctx is done, releasing any connection
+// it holds; the generator cancels ctx on timeout and when it stops.
+type ContextCaller interface {
+	BuildReq() RawRequest
+	CallContext(ctx context.Context, req []byte) ([]byte, error)
+	CheckResp(req RawRequest, resp RawResponse) *CallResult
+}
+
+type contextCallerAdapter struct {
+	Caller
+}
+
+func (receiver *contextCallerAdapter) CallContext(ctx context.Context, req []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var timeoutNS time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		timeoutNS = time.Until(deadline)
+	}
+	return receiver.Call(req, timeoutNS)
+}
+
+// NewContextCallerAdapter lets a plain Caller run where a ContextCaller is
+// expected. The remaining time until the context deadline is passed as
+// timeoutNS, but a call already running can't be cancelled.
+// A Caller that already implements ContextCaller is returned as is.
+func NewContextCallerAdapter(caller Caller) ContextCaller {
+	if contextCaller, ok := caller.(ContextCaller); ok {
+		return contextCaller
+	}
+	return &contextCallerAdapter{Caller: caller}
+}
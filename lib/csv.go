@@ -0,0 +1,155 @@
+package lib
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RESULT_CSV_HEADER is the column set of the CSV sink, one row per result:
+//
+//	id                the result ID, 0 for events
+//	code, code_name   the RetCode and its GetRetCodePlain label
+//	msg               the result message, the event type for events
+//	elapse_ns         the service time
+//	response_time_ns  the time from the intended send time to the result
+//	scheduled_at      the intended send time, RFC 3339 with nanoseconds
+//	started_at        the moment the call started
+//	stage, spike      the stage and the 1-based spike index the call was issued in
+//	warm_up           true for calls issued during the warm-up
+//	arrival           the name of the arrival distribution
+var RESULT_CSV_HEADER = []string{"id", "code", "code_name", "msg", "elapse_ns", "response_time_ns", "scheduled_at", "started_at", "stage", "spike", "warm_up", "arrival"}
+
+// TIME_SERIES_CSV_HEADER is the column set of WriteTimeSeriesCSV, one row per window:
+//
+//	start                    the start of the window, RFC 3339 with nanoseconds
+//	length_ns                the length of the window
+//	sent, completed          the calls started and the results delivered in the window
+//	succeeded, failed        the results with and without RET_CODE_SUCCESS
+//	timeout ... fatal_call   the results per failing RetCode
+//	min_ns ... max_ns        the latency of the results, see LatencySummary
+//	warm_up                  true for windows that began during the warm-up
+var TIME_SERIES_CSV_HEADER = []string{"start", "length_ns", "sent", "completed", "succeeded", "failed",
+	"timeout", "err_call", "err_response", "err_callee", "fatal_call",
+	"min_ns", "mean_ns", "p50_ns", "p90_ns", "p99_ns", "p999_ns", "max_ns", "warm_up"}
+
+func formatCSVTime(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.Format(time.RFC3339Nano)
+}
+
+func formatCSVDuration(value time.Duration) string {
+	return strconv.FormatInt(int64(value), 10)
+}
+
+func formatCSVUint(value uint64) string {
+	return strconv.FormatUint(value, 10)
+}
+
+type csvSink struct {
+	lock   sync.Mutex
+	writer *csv.Writer
+	closer io.Closer
+}
+
+func (receiver *csvSink) Put(result *CallResult) bool {
+	row := []string{
+		strconv.FormatInt(result.ID, 10),
+		strconv.Itoa(int(result.Code)),
+		GetRetCodePlain(result.Code),
+		result.Msg,
+		formatCSVDuration(result.Elapse),
+		formatCSVDuration(result.ResponseTime),
+		formatCSVTime(result.ScheduledAt),
+		formatCSVTime(result.StartedAt),
+		strconv.Itoa(result.Stage),
+		strconv.Itoa(result.Spike),
+		strconv.FormatBool(result.WarmUp),
+		result.Arrival,
+	}
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	if err := receiver.writer.Write(row); err != nil {
+		return false
+	}
+	receiver.writer.Flush()
+	return receiver.writer.Error() == nil
+}
+
+func (receiver *csvSink) Close() error {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	receiver.writer.Flush()
+	err := receiver.writer.Error()
+	if receiver.closer != nil {
+		if closeErr := receiver.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func newCSVSink(writer io.Writer, closer io.Closer) (ResultSink, error) {
+	sink := &csvSink{writer: csv.NewWriter(writer), closer: closer}
+	if err := sink.writer.Write(RESULT_CSV_HEADER); err != nil {
+		return nil, err
+	}
+	sink.writer.Flush()
+	return sink, sink.writer.Error()
+}
+
+// NewCSVSink writes the results to writer as CSV with RESULT_CSV_HEADER,
+// flushing every row so a killed run keeps what was delivered.
+func NewCSVSink(writer io.Writer) (ResultSink, error) {
+	return newCSVSink(writer, nil)
+}
+
+// CreateCSVFile writes the results to a new CSV file at path and closes it with the sink.
+func CreateCSVFile(path string) (ResultSink, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := newCSVSink(file, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return sink, nil
+}
+
+// WriteTimeSeriesCSV writes the windows as CSV with TIME_SERIES_CSV_HEADER.
+func WriteTimeSeriesCSV(writer io.Writer, windows []TimeWindow) error {
+	csvWriter := csv.NewWriter(writer)
+	csvWriter.Write(TIME_SERIES_CSV_HEADER)
+	for _, window := range windows {
+		csvWriter.Write([]string{
+			formatCSVTime(window.Start),
+			formatCSVDuration(window.Length),
+			formatCSVUint(window.Sent),
+			formatCSVUint(window.Completed),
+			formatCSVUint(window.Succeeded),
+			formatCSVUint(window.Failed),
+			formatCSVUint(window.Codes[RET_CODE_WARNING_TIMEOUT]),
+			formatCSVUint(window.Codes[RET_CODE_ERR_CALL]),
+			formatCSVUint(window.Codes[RET_CODE_ERR_RESPONSE]),
+			formatCSVUint(window.Codes[RET_CODE_ERR_CALLEE]),
+			formatCSVUint(window.Codes[RET_CODE_FATAL_CALL]),
+			formatCSVDuration(window.Latency.Min),
+			formatCSVDuration(window.Latency.Mean),
+			formatCSVDuration(window.Latency.P50),
+			formatCSVDuration(window.Latency.P90),
+			formatCSVDuration(window.Latency.P99),
+			formatCSVDuration(window.Latency.P999),
+			formatCSVDuration(window.Latency.Max),
+			strconv.FormatBool(window.WarmUp),
+		})
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
@@ -0,0 +1,40 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCSVSink(t *testing.T) {
+	var buffer bytes.Buffer
+	sink, err := NewCSVSink(&buffer)
+	assert.Nil(t, err)
+	scheduledAt := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	assert.True(t, sink.Put(&CallResult{ID: 1, Code: RET_CODE_WARNING_TIMEOUT, Msg: "Timeout, \"slow\"", Elapse: time.Millisecond, ScheduledAt: scheduledAt, Spike: 2, WarmUp: true, Arrival: "poisson"}))
+	assert.Nil(t, sink.Close())
+
+	rows, err := csv.NewReader(&buffer).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{
+		RESULT_CSV_HEADER,
+		{"1", "1001", "Call Timeout Warning", "Timeout, \"slow\"", "1000000", "0", "2020-01-02T03:04:05.000000006Z", "", "0", "2", "true", "poisson"},
+	}, rows)
+}
+
+func TestWriteTimeSeriesCSV(t *testing.T) {
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	windows := []TimeWindow{{Start: start, Length: time.Second, Sent: 10, Completed: 9, Succeeded: 7, Failed: 2,
+		Codes: map[RetCode]uint64{RET_CODE_SUCCESS: 7, RET_CODE_ERR_CALL: 2}, Latency: LatencySummary{Max: time.Millisecond}}}
+	var buffer bytes.Buffer
+	assert.Nil(t, WriteTimeSeriesCSV(&buffer, windows))
+
+	rows, err := csv.NewReader(&buffer).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{
+		TIME_SERIES_CSV_HEADER,
+		{"2020-01-02T03:04:05Z", "1000000000", "10", "9", "7", "2", "0", "2", "0", "0", "0", "0", "0", "0", "0", "0", "0", "1000000", "false"},
+	}, rows)
+}
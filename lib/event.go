@@ -0,0 +1,42 @@
+package lib
+
+import "time"
+
+type EventType int
+
+const (
+	EVENT_RATE_CHANGED    EventType = 1
+	EVENT_TIMEOUT_CHANGED EventType = 2
+	EVENT_SPIKE_STARTED   EventType = 3
+	EVENT_SPIKE_ENDED     EventType = 4
+)
+
+// Event marks something the generator did during a run. Events travel through
+// the result stream as a CallResult with Code RET_CODE_EVENT, so they keep
+// their place in the timeline relative to the calls around them.
+type Event struct {
+	Type      EventType
+	Time      time.Time
+	PPS       uint64
+	TimeoutNS time.Duration
+	// Spike is the 1-based index of the spike a spike event belongs to.
+	Spike int
+}
+
+// GetEventTypePlain ...
+func GetEventTypePlain(eventType EventType) string {
+	var typePlain string
+	switch eventType {
+	case EVENT_RATE_CHANGED:
+		typePlain = "Rate Changed"
+	case EVENT_TIMEOUT_CHANGED:
+		typePlain = "Timeout Changed"
+	case EVENT_SPIKE_STARTED:
+		typePlain = "Spike Started"
+	case EVENT_SPIKE_ENDED:
+		typePlain = "Spike Ended"
+	default:
+		typePlain = "Unknown event type"
+	}
+	return typePlain
+}
@@ -3,20 +3,34 @@ package lib
 import (
 	"errors"
 	"fmt"
+	"sync"
 )
 
 type GoroutinePoolTickets interface {
 	Take()
+	// TryTake takes a ticket if one is free and reports whether it did, without blocking.
+	TryTake() bool
+	// TakeUntil waits for a ticket like Take, but gives up and returns false once done is closed.
+	TakeUntil(done <-chan struct{}) bool
 	PutBack()
 	Active() bool
 	Total() uint64
 	RemainingTickets() uint64
+	// PeakInUse returns the most tickets taken at once since the last ResetPeak.
+	PeakInUse() uint64
+	ResetPeak()
+	// Resize changes the number of tickets. Tickets already taken beyond the
+	// new total are honoured; Take blocks until enough of them are put back.
+	Resize(total uint64) error
 }
 
 type goroutinePoolTickets struct {
-	total      uint64
-	ticketChan chan struct{}
-	active     bool
+	lock   sync.Mutex
+	cond   *sync.Cond
+	total  uint64
+	inUse  uint64
+	peak   uint64
+	active bool
 }
 
 func (receiver *goroutinePoolTickets) init(total uint64) bool {
@@ -27,12 +41,7 @@ func (receiver *goroutinePoolTickets) init(total uint64) bool {
 		return false
 	}
 
-	ch := make(chan struct{}, total)
-	for i := 0; i < int(total); i++ {
-		ch <- struct{}{}
-	}
-
-	receiver.ticketChan = ch
+	receiver.cond = sync.NewCond(&receiver.lock)
 	receiver.total = total
 	receiver.active = true
 
@@ -40,11 +49,67 @@ func (receiver *goroutinePoolTickets) init(total uint64) bool {
 }
 
 func (receiver *goroutinePoolTickets) Take() {
-	<-receiver.ticketChan
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	for receiver.inUse >= receiver.total {
+		receiver.cond.Wait()
+	}
+	receiver.take()
+}
+
+func (receiver *goroutinePoolTickets) TryTake() bool {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	if receiver.inUse >= receiver.total {
+		return false
+	}
+	receiver.take()
+	return true
+}
+
+func (receiver *goroutinePoolTickets) TakeUntil(done <-chan struct{}) bool {
+	if receiver.TryTake() {
+		return true
+	}
+	// Waiters only wake up on the cond, so closing done has to broadcast on it.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-done:
+			receiver.lock.Lock()
+			receiver.cond.Broadcast()
+			receiver.lock.Unlock()
+		case <-stop:
+		}
+	}()
+
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	for receiver.inUse >= receiver.total {
+		select {
+		case <-done:
+			return false
+		default:
+		}
+		receiver.cond.Wait()
+	}
+	receiver.take()
+	return true
+}
+
+func (receiver *goroutinePoolTickets) take() {
+	receiver.inUse++
+	if receiver.inUse > receiver.peak {
+		receiver.peak = receiver.inUse
+	}
 }
 
 func (receiver *goroutinePoolTickets) PutBack() {
-	receiver.ticketChan <- struct{}{}
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	receiver.inUse--
+	receiver.cond.Signal()
 }
 
 func (receiver *goroutinePoolTickets) Active() bool {
@@ -52,13 +117,43 @@ func (receiver *goroutinePoolTickets) Active() bool {
 }
 
 func (receiver *goroutinePoolTickets) RemainingTickets() uint64 {
-	return uint64(len(receiver.ticketChan))
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	if receiver.inUse >= receiver.total {
+		return 0
+	}
+	return receiver.total - receiver.inUse
+}
+
+func (receiver *goroutinePoolTickets) PeakInUse() uint64 {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	return receiver.peak
+}
+
+func (receiver *goroutinePoolTickets) ResetPeak() {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	receiver.peak = receiver.inUse
 }
 
 func (receiver *goroutinePoolTickets) Total() uint64 {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
 	return receiver.total
 }
 
+func (receiver *goroutinePoolTickets) Resize(total uint64) error {
+	if total == 0 {
+		return errors.New("Can't resize goroutinePoolTickets to total=0")
+	}
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	receiver.total = total
+	receiver.cond.Broadcast()
+	return nil
+}
+
 func NewGoroutinePoolTickets(total uint64) (GoroutinePoolTickets, error) {
 	gpt := goroutinePoolTickets{}
 	if !gpt.init(total) {
@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestGoroutinePoolTicketsResize(t *testing.T) {
+	_, err := NewGoroutinePoolTickets(0)
+	assert.NotNil(t, err)
+
+	tickets, err := NewGoroutinePoolTickets(2)
+	assert.Nil(t, err)
+	tickets.Take()
+	tickets.Take()
+	assert.Equal(t, uint64(0), tickets.RemainingTickets())
+
+	taken := make(chan struct{})
+	go func() {
+		tickets.Take()
+		close(taken)
+	}()
+	select {
+	case <-taken:
+		t.Fatal("Take didn't block on an exhausted pool")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	assert.Nil(t, tickets.Resize(3))
+	select {
+	case <-taken:
+	case <-time.After(time.Second):
+		t.Fatal("Take didn't return after the pool grew")
+	}
+	assert.Equal(t, uint64(3), tickets.Total())
+
+	assert.Nil(t, tickets.Resize(1))
+	assert.Equal(t, uint64(0), tickets.RemainingTickets())
+	tickets.PutBack()
+	tickets.PutBack()
+	assert.Equal(t, uint64(0), tickets.RemainingTickets())
+	tickets.PutBack()
+	assert.Equal(t, uint64(1), tickets.RemainingTickets())
+	assert.NotNil(t, tickets.Resize(0))
+}
+
+func TestGoroutinePoolTicketsTryTake(t *testing.T) {
+	tickets, err := NewGoroutinePoolTickets(1)
+	assert.Nil(t, err)
+	assert.True(t, tickets.TryTake())
+	assert.False(t, tickets.TryTake())
+	tickets.PutBack()
+	assert.True(t, tickets.TryTake())
+}
+
+func TestGoroutinePoolTicketsTakeUntil(t *testing.T) {
+	tickets, err := NewGoroutinePoolTickets(1)
+	assert.Nil(t, err)
+	done := make(chan struct{})
+	assert.True(t, tickets.TakeUntil(done))
+
+	taken := make(chan bool)
+	go func() {
+		taken <- tickets.TakeUntil(done)
+	}()
+	tickets.PutBack()
+	assert.True(t, <-taken)
+
+	go func() {
+		taken <- tickets.TakeUntil(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(done)
+	assert.False(t, <-taken)
+	assert.Equal(t, uint64(0), tickets.RemainingTickets())
+}
+
+func TestGoroutinePoolTicketsPeak(t *testing.T) {
+	tickets, err := NewGoroutinePoolTickets(3)
+	assert.Nil(t, err)
+	tickets.Take()
+	tickets.Take()
+	tickets.PutBack()
+	assert.Equal(t, uint64(2), tickets.PeakInUse())
+	tickets.ResetPeak()
+	assert.Equal(t, uint64(1), tickets.PeakInUse())
+}
@@ -0,0 +1,207 @@
+package lib
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+const (
+	// histogramSubBucketBits sets the precision: values are told apart to within 1/1024.
+	histogramSubBucketBits  = 11
+	histogramSubBucketCount = 1 << histogramSubBucketBits
+	histogramSubBucketHalf  = histogramSubBucketCount / 2
+	// HISTOGRAM_MAX_VALUE is the largest value told apart, longer ones are
+	// counted as HISTOGRAM_MAX_VALUE. Min, Max, Mean and StdDev stay exact.
+	HISTOGRAM_MAX_VALUE = time.Hour
+)
+
+var histogramBuckets = histogramIndex(int64(HISTOGRAM_MAX_VALUE)) + 1
+
+// Histogram records durations into log-linear buckets, like an HDR histogram:
+// memory is fixed (about 270KB) whatever the number of values, and every
+// percentile is accurate to within 0.1%. It isn't safe for concurrent use.
+type Histogram struct {
+	counts []uint64
+	count  uint64
+	min    time.Duration
+	max    time.Duration
+	// mean and m2 follow Welford's algorithm for the variance.
+	mean float64
+	m2   float64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{counts: make([]uint64, histogramBuckets)}
+}
+
+func histogramIndex(value int64) int {
+	shift := bits.Len64(uint64(value)) - histogramSubBucketBits
+	if shift < 0 {
+		shift = 0
+	}
+	return shift*histogramSubBucketHalf + int(value>>uint(shift))
+}
+
+// histogramValue returns the highest value that falls into the bucket at index.
+func histogramValue(index int) int64 {
+	if index < histogramSubBucketCount {
+		return int64(index)
+	}
+	shift := (index-histogramSubBucketCount)/histogramSubBucketHalf + 1
+	sub := int64((index-histogramSubBucketCount)%histogramSubBucketHalf + histogramSubBucketHalf)
+	return (sub+1)<<uint(shift) - 1
+}
+
+// Reset forgets every value recorded so far.
+func (receiver *Histogram) Reset() {
+	for i := range receiver.counts {
+		receiver.counts[i] = 0
+	}
+	receiver.count = 0
+	receiver.min = 0
+	receiver.max = 0
+	receiver.mean = 0
+	receiver.m2 = 0
+}
+
+// Record adds one value, negative values count as 0.
+func (receiver *Histogram) Record(value time.Duration) {
+	if value < 0 {
+		value = 0
+	}
+	bucketed := value
+	if bucketed > HISTOGRAM_MAX_VALUE {
+		bucketed = HISTOGRAM_MAX_VALUE
+	}
+	receiver.counts[histogramIndex(int64(bucketed))]++
+	if receiver.count == 0 || value < receiver.min {
+		receiver.min = value
+	}
+	if value > receiver.max {
+		receiver.max = value
+	}
+	receiver.count++
+	delta := float64(value) - receiver.mean
+	receiver.mean += delta / float64(receiver.count)
+	receiver.m2 += delta * (float64(value) - receiver.mean)
+}
+
+// Merge adds all values recorded in other.
+func (receiver *Histogram) Merge(other *Histogram) {
+	if other.count == 0 {
+		return
+	}
+	for i, count := range other.counts {
+		receiver.counts[i] += count
+	}
+	if receiver.count == 0 || other.min < receiver.min {
+		receiver.min = other.min
+	}
+	if other.max > receiver.max {
+		receiver.max = other.max
+	}
+	total := float64(receiver.count + other.count)
+	delta := other.mean - receiver.mean
+	receiver.m2 += other.m2 + delta*delta*float64(receiver.count)*float64(other.count)/total
+	receiver.mean += delta * float64(other.count) / total
+	receiver.count += other.count
+}
+
+func (receiver *Histogram) Count() uint64 {
+	return receiver.count
+}
+
+func (receiver *Histogram) Min() time.Duration {
+	return receiver.min
+}
+
+func (receiver *Histogram) Max() time.Duration {
+	return receiver.max
+}
+
+func (receiver *Histogram) Mean() time.Duration {
+	return time.Duration(receiver.mean)
+}
+
+// StdDev returns the population standard deviation.
+func (receiver *Histogram) StdDev() time.Duration {
+	if receiver.count == 0 {
+		return 0
+	}
+	return time.Duration(math.Sqrt(receiver.m2 / float64(receiver.count)))
+}
+
+// HistogramBar counts the values from From up to, but not including, To.
+type HistogramBar struct {
+	From  time.Duration
+	To    time.Duration
+	Count uint64
+}
+
+// Bars regroups the recorded values into count bars of equal width on a log
+// scale between Min and Max, for plotting. The last bar includes Max.
+func (receiver *Histogram) Bars(count int) []HistogramBar {
+	if receiver.count == 0 || count <= 0 {
+		return nil
+	}
+	low := float64(receiver.min)
+	if low < 1 {
+		low = 1
+	}
+	high := float64(receiver.max)
+	if high <= low {
+		return []HistogramBar{{From: receiver.min, To: receiver.max, Count: receiver.count}}
+	}
+	ratio := math.Pow(high/low, 1/float64(count))
+	bars := make([]HistogramBar, count)
+	edge := low
+	for i := range bars {
+		bars[i].From = time.Duration(edge)
+		edge *= ratio
+		bars[i].To = time.Duration(edge)
+	}
+	bars[0].From = receiver.min
+	bars[count-1].To = receiver.max
+	for i, bucketCount := range receiver.counts {
+		if bucketCount == 0 {
+			continue
+		}
+		value := float64(histogramValue(i))
+		bar := 0
+		if value > low {
+			bar = int(math.Log(value/low) / math.Log(ratio))
+		}
+		if bar >= count {
+			bar = count - 1
+		}
+		bars[bar].Count += bucketCount
+	}
+	return bars
+}
+
+// ValueAtPercentile returns the value that p percent of the recorded values are at or below.
+func (receiver *Histogram) ValueAtPercentile(p float64) time.Duration {
+	if receiver.count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(receiver.count)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for i, count := range receiver.counts {
+		seen += count
+		if seen >= rank {
+			value := time.Duration(histogramValue(i))
+			if value > receiver.max {
+				value = receiver.max
+			}
+			if value < receiver.min {
+				value = receiver.min
+			}
+			return value
+		}
+	}
+	return receiver.max
+}
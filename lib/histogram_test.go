@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestHistogramPercentiles(t *testing.T) {
+	histogram := NewHistogram()
+	assert.Equal(t, time.Duration(0), histogram.ValueAtPercentile(99))
+
+	for i := 1; i <= 10000; i++ {
+		histogram.Record(time.Duration(i) * time.Microsecond)
+	}
+	assert.Equal(t, uint64(10000), histogram.Count())
+	assert.Equal(t, time.Microsecond, histogram.Min())
+	assert.Equal(t, 10*time.Millisecond, histogram.Max())
+	assert.Equal(t, 5000500*time.Nanosecond, histogram.Mean())
+	assert.InDelta(t, float64(2886751*time.Nanosecond), float64(histogram.StdDev()), float64(time.Microsecond))
+	for _, p := range []float64{50, 90, 99, 99.9, 99.99, 99.999} {
+		expected := float64(p * 100 * float64(time.Microsecond))
+		assert.InDelta(t, expected, float64(histogram.ValueAtPercentile(p)), expected/1000+1, "p%v", p)
+	}
+	assert.Equal(t, 10*time.Millisecond, histogram.ValueAtPercentile(100))
+}
+
+func TestHistogramMerge(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	whole, first, second := NewHistogram(), NewHistogram(), NewHistogram()
+	var values []time.Duration
+	for i := 0; i < 10000; i++ {
+		value := time.Duration(random.ExpFloat64() * float64(time.Millisecond))
+		values = append(values, value)
+		whole.Record(value)
+		if i%2 == 0 {
+			first.Record(value)
+		} else {
+			second.Record(value)
+		}
+	}
+	first.Merge(second)
+	assert.Equal(t, whole.Count(), first.Count())
+	assert.Equal(t, whole.Min(), first.Min())
+	assert.Equal(t, whole.Max(), first.Max())
+	assert.InDelta(t, float64(whole.Mean()), float64(first.Mean()), 1)
+	assert.InDelta(t, float64(whole.StdDev()), float64(first.StdDev()), 1)
+	assert.Equal(t, whole.ValueAtPercentile(99), first.ValueAtPercentile(99))
+
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	exact := values[9899]
+	assert.InDelta(t, float64(exact), float64(whole.ValueAtPercentile(99)), float64(exact)/1000)
+}
+
+func TestHistogramClamp(t *testing.T) {
+	histogram := NewHistogram()
+	histogram.Record(-time.Second)
+	histogram.Record(2 * HISTOGRAM_MAX_VALUE)
+	assert.Equal(t, time.Duration(0), histogram.Min())
+	assert.Equal(t, 2*HISTOGRAM_MAX_VALUE, histogram.Max())
+	assert.InDelta(t, float64(HISTOGRAM_MAX_VALUE), float64(histogram.ValueAtPercentile(100)), float64(HISTOGRAM_MAX_VALUE)/1000)
+}
+
+func TestHistogramBars(t *testing.T) {
+	histogram := NewHistogram()
+	assert.Nil(t, histogram.Bars(10))
+	for i := 1; i <= 1000; i++ {
+		histogram.Record(time.Duration(i) * time.Microsecond)
+	}
+	bars := histogram.Bars(3)
+	assert.Equal(t, 3, len(bars))
+	assert.Equal(t, time.Microsecond, bars[0].From)
+	assert.Equal(t, time.Millisecond, bars[2].To)
+	assert.InDelta(t, float64(10*time.Microsecond), float64(bars[0].To), float64(time.Microsecond)/100)
+	var total uint64
+	for _, bar := range bars {
+		total += bar.Count
+	}
+	assert.Equal(t, uint64(1000), total)
+	assert.InDelta(t, 900, float64(bars[2].Count), 2)
+
+	single := NewHistogram()
+	single.Record(time.Millisecond)
+	single.Record(time.Millisecond)
+	assert.Equal(t, []HistogramBar{{From: time.Millisecond, To: time.Millisecond, Count: 2}}, single.Bars(5))
+}
@@ -0,0 +1,129 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// jsonLinesSink writes one result per line, as encoded by MarshalResult:
+// ID, Code, Msg, Elapse, ScheduledAt, StartedAt, ResponseTime, Stage, Spike,
+// WarmUp, Arrival and Event, with durations in nanoseconds. Request and
+// response bodies are left empty unless includeBodies is set.
+type jsonLinesSink struct {
+	lock          sync.Mutex
+	writer        *bufio.Writer
+	closer        io.Closer
+	includeBodies bool
+}
+
+// Put writes and flushes the line right away, so a run that is killed
+// leaves every result delivered so far in the file.
+func (receiver *jsonLinesSink) Put(result *CallResult) bool {
+	record := *result
+	if !receiver.includeBodies {
+		record.Req.Req = nil
+		record.Resp.Resp = nil
+	}
+	data, err := MarshalResult(&record)
+	if err != nil {
+		return false
+	}
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	if _, err := receiver.writer.Write(append(data, '\n')); err != nil {
+		return false
+	}
+	return receiver.writer.Flush() == nil
+}
+
+func (receiver *jsonLinesSink) Close() error {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	err := receiver.writer.Flush()
+	if receiver.closer != nil {
+		if closeErr := receiver.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// NewJSONLinesSink writes the results to writer as JSON Lines.
+func NewJSONLinesSink(writer io.Writer, includeBodies bool) ResultSink {
+	return &jsonLinesSink{writer: bufio.NewWriter(writer), includeBodies: includeBodies}
+}
+
+// CreateJSONLinesFile writes the results to a new file at path as JSON Lines
+// and closes it with the sink.
+func CreateJSONLinesFile(path string, includeBodies bool) (ResultSink, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonLinesSink{writer: bufio.NewWriter(file), closer: file, includeBodies: includeBodies}, nil
+}
+
+// JSONLinesReader streams the results written by a JSON Lines sink.
+type JSONLinesReader struct {
+	reader    *bufio.Reader
+	truncated bool
+}
+
+func NewJSONLinesReader(reader io.Reader) *JSONLinesReader {
+	return &JSONLinesReader{reader: bufio.NewReader(reader)}
+}
+
+// Next returns the next result and io.EOF after the last one. A last line cut
+// short, as left by a run that was killed, is skipped and marks the reader Truncated.
+func (receiver *JSONLinesReader) Next() (*CallResult, error) {
+	for {
+		line, err := receiver.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		complete := err == nil
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			if !complete {
+				return nil, io.EOF
+			}
+			continue
+		}
+		result, decodeErr := UnmarshalResult(line)
+		if decodeErr != nil {
+			if !complete {
+				receiver.truncated = true
+				return nil, io.EOF
+			}
+			return nil, decodeErr
+		}
+		return result, nil
+	}
+}
+
+// Truncated reports whether the last line was cut short.
+func (receiver *JSONLinesReader) Truncated() bool {
+	return receiver.truncated
+}
+
+// ReadResults streams every result of a JSON Lines file into sink, an
+// Aggregator or a fan-out of them for instance, and returns how many it read.
+// The sink isn't closed.
+func ReadResults(reader io.Reader, sink ResultSink) (uint64, error) {
+	results := NewJSONLinesReader(reader)
+	var count uint64
+	for {
+		result, err := results.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		PutWait(sink, result, nil)
+		count++
+	}
+}
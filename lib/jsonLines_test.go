@@ -0,0 +1,80 @@
+package lib
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONLinesRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "results")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "results.jsonl")
+
+	sink, err := CreateJSONLinesFile(path, false)
+	assert.Nil(t, err)
+	written := NewAggregator()
+	for i := int64(1); i <= 100; i++ {
+		result := &CallResult{ID: i, Req: RawRequest{ID: i, Req: []byte("ping")}, Code: RET_CODE_SUCCESS, Elapse: time.Duration(i) * time.Millisecond, StartedAt: time.Now()}
+		if i%10 == 0 {
+			result.Code = RET_CODE_WARNING_TIMEOUT
+		}
+		assert.True(t, sink.Put(result))
+		written.Add(result)
+	}
+	assert.True(t, sink.Put(&CallResult{Code: RET_CODE_EVENT, Event: &Event{Type: EVENT_RATE_CHANGED, PPS: 10}}))
+	assert.Nil(t, sink.Close())
+
+	file, err := os.Open(path)
+	assert.Nil(t, err)
+	defer file.Close()
+	read := NewAggregator()
+	count, err := ReadResults(file, read)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(101), count)
+	assert.Equal(t, written.Success(), read.Success())
+	assert.Equal(t, written.ByCode(RET_CODE_WARNING_TIMEOUT), read.ByCode(RET_CODE_WARNING_TIMEOUT))
+
+	file.Seek(0, io.SeekStart)
+	first, err := NewJSONLinesReader(file).Next()
+	assert.Nil(t, err)
+	assert.Nil(t, first.Req.Req)
+}
+
+func TestJSONLinesBodies(t *testing.T) {
+	var buffer bytes.Buffer
+	sink := NewJSONLinesSink(&buffer, true)
+	sink.Put(&CallResult{ID: 1, Req: RawRequest{ID: 1, Req: []byte("ping")}, Resp: RawResponse{ID: 1, Resp: []byte("pong")}})
+	result, err := NewJSONLinesReader(&buffer).Next()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("ping"), result.Req.Req)
+	assert.Equal(t, []byte("pong"), result.Resp.Resp)
+}
+
+func TestJSONLinesTruncated(t *testing.T) {
+	var buffer bytes.Buffer
+	sink := NewJSONLinesSink(&buffer, false)
+	sink.Put(&CallResult{ID: 1})
+	sink.Put(&CallResult{ID: 2})
+	data := buffer.String()
+	cut := data[:len(data)-10]
+
+	reader := NewJSONLinesReader(strings.NewReader(cut))
+	result, err := reader.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.ID)
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+	assert.True(t, reader.Truncated())
+
+	_, err = NewJSONLinesReader(strings.NewReader("{broken\n{}\n")).Next()
+	assert.NotNil(t, err)
+	assert.NotEqual(t, io.EOF, err)
+}
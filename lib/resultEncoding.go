@@ -0,0 +1,36 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// resultRecord is the JSON form of a CallResult. The response error is kept
+// as text, an error interface can't be decoded again.
+type resultRecord struct {
+	CallResult
+	RespErr string `json:",omitempty"`
+}
+
+// MarshalResult encodes result as a single line of JSON.
+func MarshalResult(result *CallResult) ([]byte, error) {
+	record := resultRecord{CallResult: *result}
+	if result.Resp.Err != nil {
+		record.RespErr = result.Resp.Err.Error()
+		record.Resp.Err = nil
+	}
+	return json.Marshal(&record)
+}
+
+// UnmarshalResult decodes a result encoded by MarshalResult.
+func UnmarshalResult(data []byte) (*CallResult, error) {
+	var record resultRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	result := record.CallResult
+	if record.RespErr != "" {
+		result.Resp.Err = errors.New(record.RespErr)
+	}
+	return &result, nil
+}
@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"sync"
+	"time"
+)
+
+// ResultSink consumes the call results and events of a run.
+type ResultSink interface {
+	// Put delivers one result and reports whether the sink accepted it. It's
+	// called from many goroutines at once and must not block: a sink that
+	// can't keep up returns false and the result counts as ignored.
+	Put(result *CallResult) bool
+	// Close is called once, after the last Put of the run.
+	Close() error
+}
+
+// BlockingResultSink is a ResultSink that can wait for room instead of refusing a result.
+type BlockingResultSink interface {
+	ResultSink
+	// PutWait waits until the sink takes result, and gives up returning false once done is closed.
+	PutWait(result *CallResult, done <-chan struct{}) bool
+}
+
+// PutWait delivers result to sink, waiting as long as the sink refuses it.
+// It gives up and returns false once done is closed, a nil done waits for good.
+// A sink that may accept a result in part, like a fan-out, must implement
+// BlockingResultSink, otherwise the accepting part gets it again on every retry.
+func PutWait(sink ResultSink, result *CallResult, done <-chan struct{}) bool {
+	if blocking, ok := sink.(BlockingResultSink); ok {
+		return blocking.PutWait(result, done)
+	}
+	for !sink.Put(result) {
+		select {
+		case <-done:
+			return false
+		case <-time.After(100 * time.Microsecond):
+		}
+	}
+	return true
+}
+
+type channelSink struct {
+	resultChan chan *CallResult
+}
+
+func (receiver *channelSink) Put(result *CallResult) bool {
+	select {
+	case receiver.resultChan <- result:
+		return true
+	default:
+		return false
+	}
+}
+
+func (receiver *channelSink) PutWait(result *CallResult, done <-chan struct{}) bool {
+	select {
+	case receiver.resultChan <- result:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func (receiver *channelSink) Close() error {
+	close(receiver.resultChan)
+	return nil
+}
+
+// NewChannelSink delivers results to resultChan, refusing them while it is
+// full, and closes it at the end of the run.
+func NewChannelSink(resultChan chan *CallResult) ResultSink {
+	return &channelSink{resultChan: resultChan}
+}
+
+type fanOutSink struct {
+	sinks []ResultSink
+}
+
+func (receiver *fanOutSink) Put(result *CallResult) bool {
+	accepted := true
+	for _, sink := range receiver.sinks {
+		if !sink.Put(result) {
+			accepted = false
+		}
+	}
+	return accepted
+}
+
+func (receiver *fanOutSink) PutWait(result *CallResult, done <-chan struct{}) bool {
+	for _, sink := range receiver.sinks {
+		if !PutWait(sink, result, done) {
+			return false
+		}
+	}
+	return true
+}
+
+func (receiver *fanOutSink) Close() error {
+	var firstErr error
+	for _, sink := range receiver.sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// NewFanOutSink delivers every result to all sinks, in order. A result counts
+// as accepted only if every sink accepted it. Close closes all sinks and
+// returns the first error.
+func NewFanOutSink(sinks ...ResultSink) ResultSink {
+	return &fanOutSink{sinks: append([]ResultSink(nil), sinks...)}
+}
+
+type funcSink struct {
+	lock sync.Mutex
+	fn   func(result *CallResult)
+}
+
+func (receiver *funcSink) Put(result *CallResult) bool {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	receiver.fn(result)
+	return true
+}
+
+func (receiver *funcSink) Close() error {
+	return nil
+}
+
+// NewFuncSink calls fn with every result, one at a time.
+func NewFuncSink(fn func(result *CallResult)) ResultSink {
+	return &funcSink{fn: fn}
+}
@@ -0,0 +1,46 @@
+package lib
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type closeErrSink struct {
+	ResultSink
+}
+
+func (receiver *closeErrSink) Close() error {
+	return errors.New("close failed")
+}
+
+func TestChannelSink(t *testing.T) {
+	resultChan := make(chan *CallResult, 1)
+	sink := NewChannelSink(resultChan)
+	assert.True(t, sink.Put(&CallResult{ID: 1}))
+	assert.False(t, sink.Put(&CallResult{ID: 2}))
+	assert.Nil(t, sink.Close())
+	assert.Equal(t, int64(1), (<-resultChan).ID)
+	_, open := <-resultChan
+	assert.False(t, open)
+}
+
+func TestFanOutSink(t *testing.T) {
+	resultChan := make(chan *CallResult, 1)
+	var seen []int64
+	aggregator := NewAggregator()
+	sink := NewFanOutSink(NewChannelSink(resultChan), NewFuncSink(func(result *CallResult) { seen = append(seen, result.ID) }), aggregator)
+	assert.True(t, sink.Put(&CallResult{ID: 1}))
+	// The full channel refuses the second result, the other sinks still get it.
+	assert.False(t, sink.Put(&CallResult{ID: 2}))
+	assert.Equal(t, []int64{1, 2}, seen)
+	assert.Equal(t, uint64(2), aggregator.Count())
+	assert.Nil(t, sink.Close())
+	_, open := <-resultChan
+	assert.True(t, open)
+	_, open = <-resultChan
+	assert.False(t, open)
+
+	failing := NewFanOutSink(&closeErrSink{NewFuncSink(func(*CallResult) {})}, aggregator)
+	assert.NotNil(t, failing.Close())
+}
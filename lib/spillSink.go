@@ -0,0 +1,188 @@
+package lib
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// SpillSink never refuses a result. Whatever its sink refuses is appended to
+// a temporary file and replayed to the sink, in order, as soon as it has room
+// again; later results queue up behind the spilled ones. A fan-out sink is
+// spilled per inner sink, so each of them gets every result exactly once.
+// Close waits until everything was delivered, then closes the sink and
+// removes the files.
+type SpillSink struct {
+	sink  ResultSink
+	lanes []*spillLane
+
+	lock sync.Mutex
+	// spilled counts the results that went through a file for at least one sink.
+	spilled  uint64
+	closing  bool
+	failures uint64
+}
+
+// spillLane spills and replays the results of one sink.
+type spillLane struct {
+	sink   ResultSink
+	file   *os.File
+	writer *bufio.Writer
+	// written and replayed count the results that went through the file.
+	written  uint64
+	replayed uint64
+	more     *sync.Cond
+	done     chan struct{}
+}
+
+// NewSpillSink spills into temporary files in dir, the default directory for temporary files when empty.
+func NewSpillSink(sink ResultSink, dir string) (*SpillSink, error) {
+	spill := &SpillSink{sink: sink}
+	var readers []*os.File
+	for _, inner := range spillTargets(sink) {
+		file, err := ioutil.TempFile(dir, "load-generator-spill-*.jsonl")
+		if err == nil {
+			var reader *os.File
+			if reader, err = os.Open(file.Name()); err == nil {
+				readers = append(readers, reader)
+			} else {
+				file.Close()
+				os.Remove(file.Name())
+			}
+		}
+		if err != nil {
+			for i, lane := range spill.lanes {
+				readers[i].Close()
+				lane.file.Close()
+				os.Remove(lane.file.Name())
+			}
+			return nil, err
+		}
+		lane := &spillLane{sink: inner, file: file, writer: bufio.NewWriter(file), done: make(chan struct{})}
+		lane.more = sync.NewCond(&spill.lock)
+		spill.lanes = append(spill.lanes, lane)
+	}
+	for i, lane := range spill.lanes {
+		go spill.replay(lane, readers[i])
+	}
+	return spill, nil
+}
+
+// spillTargets returns the sinks a result is spilled for, the inner sinks of a fan-out.
+func spillTargets(sink ResultSink) []ResultSink {
+	fanOut, ok := sink.(*fanOutSink)
+	if !ok {
+		return []ResultSink{sink}
+	}
+	var targets []ResultSink
+	for _, inner := range fanOut.sinks {
+		targets = append(targets, spillTargets(inner)...)
+	}
+	return targets
+}
+
+// Put hands result straight to each sink while nothing is spilled for it,
+// and spills it otherwise. It only returns false if a file can't be written.
+func (receiver *SpillSink) Put(result *CallResult) bool {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	var data []byte
+	spilled, accepted := false, true
+	for _, lane := range receiver.lanes {
+		if lane.written == lane.replayed && lane.sink.Put(result) {
+			continue
+		}
+		var err error
+		if data == nil {
+			if data, err = MarshalResult(result); err == nil {
+				data = append(data, '\n')
+			}
+		}
+		if err == nil {
+			_, err = lane.writer.Write(data)
+		}
+		if err == nil {
+			err = lane.writer.Flush()
+		}
+		if err != nil {
+			receiver.failures++
+			accepted = false
+			continue
+		}
+		lane.written++
+		lane.more.Signal()
+		spilled = true
+	}
+	if spilled {
+		receiver.spilled++
+	}
+	return accepted
+}
+
+func (receiver *SpillSink) replay(lane *spillLane, reader *os.File) {
+	defer close(lane.done)
+	defer reader.Close()
+	lines := bufio.NewReader(reader)
+	for {
+		receiver.lock.Lock()
+		for lane.replayed == lane.written && !receiver.closing {
+			lane.more.Wait()
+		}
+		if lane.replayed == lane.written {
+			receiver.lock.Unlock()
+			return
+		}
+		receiver.lock.Unlock()
+
+		// Every counted line was flushed completely before it was counted.
+		line, err := lines.ReadBytes('\n')
+		if err == nil {
+			var result *CallResult
+			if result, err = UnmarshalResult(line); err == nil {
+				PutWait(lane.sink, result, nil)
+			}
+		}
+		receiver.lock.Lock()
+		if err != nil {
+			receiver.failures++
+		}
+		lane.replayed++
+		receiver.lock.Unlock()
+	}
+}
+
+// Spilled returns how many results went through a file so far.
+func (receiver *SpillSink) Spilled() uint64 {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	return receiver.spilled
+}
+
+// Failures returns how many times a sink lost a spilled result because it
+// couldn't be read back. Results that couldn't be written are refused by Put instead.
+func (receiver *SpillSink) Failures() uint64 {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	return receiver.failures
+}
+
+func (receiver *SpillSink) Close() error {
+	receiver.lock.Lock()
+	receiver.closing = true
+	for _, lane := range receiver.lanes {
+		lane.more.Signal()
+	}
+	receiver.lock.Unlock()
+	for _, lane := range receiver.lanes {
+		<-lane.done
+	}
+	err := receiver.sink.Close()
+	for _, lane := range receiver.lanes {
+		lane.file.Close()
+		if removeErr := os.Remove(lane.file.Name()); err == nil {
+			err = removeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMarshalResult(t *testing.T) {
+	result := &CallResult{ID: 7, Req: RawRequest{ID: 7, Req: []byte("ping")}, Resp: RawResponse{ID: 7, Err: errors.New("refused")}, Code: RET_CODE_ERR_CALL, Elapse: time.Millisecond}
+	data, err := MarshalResult(result)
+	assert.Nil(t, err)
+	decoded, err := UnmarshalResult(data)
+	assert.Nil(t, err)
+	assert.Equal(t, "refused", decoded.Resp.Err.Error())
+	decoded.Resp.Err = result.Resp.Err
+	assert.Equal(t, result, decoded)
+
+	event := &CallResult{Code: RET_CODE_EVENT, Event: &Event{Type: EVENT_SPIKE_STARTED, Spike: 1}}
+	data, err = MarshalResult(event)
+	assert.Nil(t, err)
+	decoded, err = UnmarshalResult(data)
+	assert.Nil(t, err)
+	assert.Equal(t, event.Event.Type, decoded.Event.Type)
+	assert.Nil(t, decoded.Resp.Err)
+}
+
+func TestSpillSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	resultChan := make(chan *CallResult, 2)
+	spill, err := NewSpillSink(NewChannelSink(resultChan), dir)
+	assert.Nil(t, err)
+
+	for i := int64(1); i <= 100; i++ {
+		assert.True(t, spill.Put(&CallResult{ID: i}))
+	}
+	assert.True(t, spill.Spilled() >= 98)
+
+	closed := make(chan error)
+	go func() {
+		closed <- spill.Close()
+	}()
+	next := int64(1)
+	for result := range resultChan {
+		assert.Equal(t, next, result.ID)
+		next++
+	}
+	assert.Equal(t, int64(101), next)
+	assert.Nil(t, <-closed)
+	assert.Equal(t, uint64(0), spill.Failures())
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+}
+
+func TestSpillSinkFanOut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	roomy := make(chan *CallResult, 200)
+	tight := make(chan *CallResult, 2)
+	spill, err := NewSpillSink(NewFanOutSink(NewChannelSink(roomy), NewChannelSink(tight)), dir)
+	assert.Nil(t, err)
+
+	// The roomy sink takes everything at once, only the tight one needs the spill file.
+	for i := int64(1); i <= 100; i++ {
+		assert.True(t, spill.Put(&CallResult{ID: i}))
+	}
+	assert.Equal(t, 100, len(roomy))
+	assert.True(t, spill.Spilled() >= 98)
+
+	closed := make(chan error)
+	go func() {
+		closed <- spill.Close()
+	}()
+	next := int64(1)
+	for result := range tight {
+		assert.Equal(t, next, result.ID)
+		next++
+	}
+	assert.Equal(t, int64(101), next)
+	assert.Nil(t, <-closed)
+	next = 1
+	for result := range roomy {
+		assert.Equal(t, next, result.ID)
+		next++
+	}
+	assert.Equal(t, int64(101), next)
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"sync"
+	"time"
+)
+
+// TimeWindow summarizes the calls of one interval of a run. Sent counts the
+// calls that started in the window; Completed, Codes and Latency the results
+// delivered in it.
+type TimeWindow struct {
+	Start     time.Time
+	Length    time.Duration
+	Sent      uint64
+	Completed uint64
+	Succeeded uint64
+	Failed    uint64
+	// Codes counts the completed calls per RetCode.
+	Codes   map[RetCode]uint64
+	Latency LatencySummary
+	// WarmUp marks windows that began during the warm-up period.
+	WarmUp bool
+}
+
+// WindowRecorder collects the calls of the current window until it is rotated.
+// It is safe for concurrent use.
+type WindowRecorder struct {
+	lock      sync.Mutex
+	start     time.Time
+	sent      uint64
+	codes     map[RetCode]uint64
+	histogram *Histogram
+}
+
+func NewWindowRecorder(start time.Time) *WindowRecorder {
+	return &WindowRecorder{start: start, codes: map[RetCode]uint64{}, histogram: NewHistogram()}
+}
+
+// Sent counts a call that started.
+func (receiver *WindowRecorder) Sent() {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	receiver.sent++
+}
+
+// Add counts a completed call, events are left out.
+func (receiver *WindowRecorder) Add(result *CallResult) {
+	if result == nil || result.IsEvent() {
+		return
+	}
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	receiver.codes[result.Code]++
+	receiver.histogram.Record(result.Elapse)
+}
+
+// Rotate ends the current window at now and starts the next one.
+func (receiver *WindowRecorder) Rotate(now time.Time) *TimeWindow {
+	receiver.lock.Lock()
+	defer receiver.lock.Unlock()
+	window := &TimeWindow{
+		Start:     receiver.start,
+		Length:    now.Sub(receiver.start),
+		Sent:      receiver.sent,
+		Completed: receiver.histogram.Count(),
+		Succeeded: receiver.codes[RET_CODE_SUCCESS],
+		Codes:     receiver.codes,
+		Latency:   Summarize(receiver.histogram),
+	}
+	window.Failed = window.Completed - window.Succeeded
+	receiver.start = now
+	receiver.sent = 0
+	receiver.codes = map[RetCode]uint64{}
+	receiver.histogram.Reset()
+	return window
+}
@@ -0,0 +1,34 @@
+package lib
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWindowRecorder(t *testing.T) {
+	start := time.Now()
+	recorder := NewWindowRecorder(start)
+	for i := 0; i < 3; i++ {
+		recorder.Sent()
+	}
+	recorder.Add(&CallResult{Code: RET_CODE_SUCCESS, Elapse: time.Millisecond})
+	recorder.Add(&CallResult{Code: RET_CODE_WARNING_TIMEOUT, Elapse: 10 * time.Millisecond})
+	recorder.Add(&CallResult{Code: RET_CODE_EVENT, Event: &Event{Type: EVENT_RATE_CHANGED}})
+
+	window := recorder.Rotate(start.Add(time.Second))
+	assert.Equal(t, start, window.Start)
+	assert.Equal(t, time.Second, window.Length)
+	assert.Equal(t, uint64(3), window.Sent)
+	assert.Equal(t, uint64(2), window.Completed)
+	assert.Equal(t, uint64(1), window.Succeeded)
+	assert.Equal(t, uint64(1), window.Failed)
+	assert.Equal(t, map[RetCode]uint64{RET_CODE_SUCCESS: 1, RET_CODE_WARNING_TIMEOUT: 1}, window.Codes)
+	assert.Equal(t, 10*time.Millisecond, window.Latency.Max)
+
+	next := recorder.Rotate(start.Add(2 * time.Second))
+	assert.Equal(t, start.Add(time.Second), next.Start)
+	assert.Equal(t, uint64(0), next.Sent)
+	assert.Equal(t, uint64(0), next.Completed)
+	assert.Equal(t, LatencySummary{}, next.Latency)
+}
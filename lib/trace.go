@@ -0,0 +1,106 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// TraceRecord is one payload captured from real traffic. Offset is relative to
+// the start of the recording and must not decrease from one record to the next.
+type TraceRecord struct {
+	Offset  time.Duration `json:"offset_ns"`
+	Payload []byte        `json:"payload"`
+}
+
+// TraceSource yields the records of a trace in order and io.EOF after the last one.
+type TraceSource interface {
+	Next() (TraceRecord, error)
+}
+
+type traceReader struct {
+	scanner *bufio.Scanner
+	line    int
+	last    time.Duration
+}
+
+func (receiver *traceReader) Next() (TraceRecord, error) {
+	var record TraceRecord
+	for receiver.scanner.Scan() {
+		receiver.line++
+		line := receiver.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return record, fmt.Errorf("Invalid trace record at line %d: %s", receiver.line, err)
+		}
+		if record.Offset < receiver.last {
+			return record, fmt.Errorf("Invalid trace record at line %d: offset %v before %v", receiver.line, record.Offset, receiver.last)
+		}
+		receiver.last = record.Offset
+		return record, nil
+	}
+	if err := receiver.scanner.Err(); err != nil {
+		return record, err
+	}
+	return record, io.EOF
+}
+
+// NewTraceReader reads a trace in JSON Lines, one record per line:
+//
+//	{"offset_ns": 1500000, "payload": "<base64 encoded bytes>"}
+func NewTraceReader(reader io.Reader) TraceSource {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	return &traceReader{scanner: scanner}
+}
+
+type traceFile struct {
+	TraceSource
+	file *os.File
+}
+
+func (receiver *traceFile) Next() (TraceRecord, error) {
+	record, err := receiver.TraceSource.Next()
+	if err != nil {
+		receiver.file.Close()
+	}
+	return record, err
+}
+
+// OpenTraceFile streams a JSON Lines trace from path, see NewTraceReader.
+// The file is closed once the trace is exhausted or fails.
+func OpenTraceFile(path string) (TraceSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &traceFile{TraceSource: NewTraceReader(file), file: file}, nil
+}
+
+type traceSlice struct {
+	records []TraceRecord
+	next    int
+}
+
+func (receiver *traceSlice) Next() (TraceRecord, error) {
+	if receiver.next >= len(receiver.records) {
+		return TraceRecord{}, io.EOF
+	}
+	record := receiver.records[receiver.next]
+	if receiver.next > 0 && record.Offset < receiver.records[receiver.next-1].Offset {
+		return record, errors.New("Invalid trace, offsets must not decrease")
+	}
+	receiver.next++
+	return record, nil
+}
+
+// NewTraceSlice replays records held in memory.
+func NewTraceSlice(records []TraceRecord) TraceSource {
+	return &traceSlice{records: records}
+}
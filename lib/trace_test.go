@@ -0,0 +1,50 @@
+package lib
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTraceReader(t *testing.T) {
+	trace := NewTraceReader(strings.NewReader(`{"offset_ns": 0, "payload": "cGluZw=="}
+
+{"offset_ns": 1500000, "payload": "cG9uZw=="}
+`))
+	record, err := trace.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), record.Offset)
+	assert.Equal(t, []byte("ping"), record.Payload)
+
+	record, err = trace.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, 1500*time.Microsecond, record.Offset)
+	assert.Equal(t, []byte("pong"), record.Payload)
+
+	_, err = trace.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestTraceReaderInvalid(t *testing.T) {
+	_, err := NewTraceReader(strings.NewReader("not json\n")).Next()
+	assert.NotNil(t, err)
+
+	trace := NewTraceReader(strings.NewReader("{\"offset_ns\": 20}\n{\"offset_ns\": 10}\n"))
+	_, err = trace.Next()
+	assert.Nil(t, err)
+	_, err = trace.Next()
+	assert.NotNil(t, err)
+	assert.NotEqual(t, io.EOF, err)
+}
+
+func TestTraceSlice(t *testing.T) {
+	trace := NewTraceSlice([]TraceRecord{{Offset: 0}, {Offset: time.Millisecond}})
+	for i := 0; i < 2; i++ {
+		_, err := trace.Next()
+		assert.Nil(t, err)
+	}
+	_, err := trace.Next()
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// main turns a JSON Lines results file into a self-contained HTML report:
+//
+//	load-generator -results results.jsonl -config config.json -out report.html
+func main() {
+	resultsPath := flag.String("results", "", "JSON Lines results file, as written by lib.CreateJSONLinesFile")
+	configPath := flag.String("config", "", "optional JSON file holding the RunConfig of the run, as written by WriteRunConfig")
+	outPath := flag.String("out", "report.html", "HTML file to write")
+	title := flag.String("title", "", "title of the report")
+	window := flag.Duration("window", DEFAULT_WINDOW, "interval of the charts over time")
+	flag.Parse()
+
+	if err := writeHTMLReportFile(*resultsPath, *configPath, *outPath, *title, *window); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func writeHTMLReportFile(resultsPath string, configPath string, outPath string, title string, window time.Duration) error {
+	if resultsPath == "" {
+		return fmt.Errorf("missing -results")
+	}
+	results, err := os.Open(resultsPath)
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	params := HTMLReportParams{Title: title, Results: results, WindowNS: window}
+	if configPath != "" {
+		file, err := os.Open(configPath)
+		if err != nil {
+			return err
+		}
+		config, err := ReadRunConfig(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %v", configPath, err)
+		}
+		params.Config = config
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	if err := WriteHTMLReport(out, params); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"load-generator/lib"
+	"strconv"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// RunMetadata describes how a run was configured and when it ran.
+type RunMetadata struct {
+	Mode         string
+	Arrival      string
+	PPS          uint64
+	Stages       int
+	Spikes       int
+	VirtualUsers uint64
+	TimeoutNS    time.Duration
+	// ProcessingDurationNS is the configured limit, 0 when only TotalRequests ends the run.
+	ProcessingDurationNS time.Duration
+	TotalRequests        uint64
+	WarmUpDurationNS     time.Duration
+	Concurrency          uint64
+	Backpressure         BackpressurePolicy
+	Delivery             DeliveryMode
+	StartedAt            time.Time
+	// EndedAt is zero while the run is going on.
+	EndedAt time.Time
+	// DurationNS is the active time of the run, pauses left out.
+	DurationNS time.Duration
+}
+
+// CodeCount is the number of calls that ended with Code, warm-up left out.
+type CodeCount struct {
+	Code    lib.RetCode
+	Label   string
+	Count   uint64
+	Latency lib.LatencySummary
+}
+
+// Report summarizes a run. Latencies are service times and leave out the warm-up.
+type Report struct {
+	Metadata RunMetadata
+	// Offered counts the payloads the schedule asked for over the whole run,
+	// dropped ones included, and OfferedPPS their rate over DurationNS.
+	Offered    uint64
+	OfferedPPS float64
+	// AchievedPPS is the rate of successful calls after the warm-up.
+	AchievedPPS float64
+	Calls       uint64
+	Codes       []CodeCount
+	Latency     lib.LatencySummary
+	// SuccessLatency covers RET_CODE_SUCCESS only.
+	SuccessLatency lib.LatencySummary
+	PeakInFlight   uint64
+	Dropped        uint64
+	// Ignored counts the results lost on the way to the result sink: refused
+	// by it, lost in the spill file, or arriving after the run ended.
+	Ignored uint64
+	// Spilled counts the results that went through the spill file.
+	Spilled      uint64
+	Abandoned    uint64
+	Cancelled    uint64
+	Late         uint64
+	Backpressure BackpressureStats
+	Scheduler    SchedulerStats
+	TimeSeries   []lib.TimeWindow
+}
+
+// SUMMARY_CSV_HEADER is the column set of WriteSummaryCSV. The first row,
+// scope "all", covers every call, then there is one row, scope "code", per RetCode:
+//
+//	scope, code, code_name    what the row covers, code is empty for "all"
+//	count                     the calls counted, warm-up left out
+//	min_ns ... max_ns         their service time, see lib.LatencySummary
+//	duration_ns ... ignored   the run figures of the Report, the same on every row
+var SUMMARY_CSV_HEADER = []string{"scope", "code", "code_name", "count",
+	"min_ns", "mean_ns", "stddev_ns", "p50_ns", "p75_ns", "p90_ns", "p95_ns", "p99_ns", "p999_ns", "p9999_ns", "p99999_ns", "max_ns",
+	"duration_ns", "offered", "offered_pps", "achieved_pps", "peak_in_flight", "dropped", "ignored"}
+
+// WriteSummaryCSV writes the latency summaries as CSV with SUMMARY_CSV_HEADER.
+func (receiver *Report) WriteSummaryCSV(writer io.Writer) error {
+	csvWriter := csv.NewWriter(writer)
+	csvWriter.Write(SUMMARY_CSV_HEADER)
+	row := func(scope string, code string, label string, latency lib.LatencySummary) {
+		values := []string{scope, code, label, strconv.FormatUint(latency.Count, 10)}
+		for _, value := range []time.Duration{latency.Min, latency.Mean, latency.StdDev, latency.P50, latency.P75, latency.P90, latency.P95, latency.P99, latency.P999, latency.P9999, latency.P99999, latency.Max, receiver.Metadata.DurationNS} {
+			values = append(values, strconv.FormatInt(int64(value), 10))
+		}
+		values = append(values,
+			strconv.FormatUint(receiver.Offered, 10),
+			strconv.FormatFloat(receiver.OfferedPPS, 'f', 2, 64),
+			strconv.FormatFloat(receiver.AchievedPPS, 'f', 2, 64),
+			strconv.FormatUint(receiver.PeakInFlight, 10),
+			strconv.FormatUint(receiver.Dropped, 10),
+			strconv.FormatUint(receiver.Ignored, 10))
+		csvWriter.Write(values)
+	}
+	row("all", "", "", receiver.Latency)
+	for _, code := range receiver.Codes {
+		row("code", strconv.Itoa(int(code.Code)), code.Label, code.Latency)
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// WriteTimeSeriesCSV writes the time series as CSV with lib.TIME_SERIES_CSV_HEADER.
+func (receiver *Report) WriteTimeSeriesCSV(writer io.Writer) error {
+	return lib.WriteTimeSeriesCSV(writer, receiver.TimeSeries)
+}
+
+// JSON serializes the report, durations in nanoseconds.
+func (receiver *Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(receiver, "", "  ")
+}
+
+// String prints the report as text.
+func (receiver *Report) String() string {
+	var buffer bytes.Buffer
+	writer := tabwriter.NewWriter(&buffer, 0, 4, 2, ' ', 0)
+	meta := receiver.Metadata
+	fmt.Fprintf(writer, "Run\n")
+	fmt.Fprintf(writer, "  Mode:\t%s, %s\n", meta.Mode, meta.Arrival)
+	fmt.Fprintf(writer, "  Started:\t%s\n", meta.StartedAt.Format(time.RFC3339))
+	if !meta.EndedAt.IsZero() {
+		fmt.Fprintf(writer, "  Ended:\t%s\n", meta.EndedAt.Format(time.RFC3339))
+	}
+	fmt.Fprintf(writer, "  Duration:\t%v (warm-up %v)\n", meta.DurationNS, meta.WarmUpDurationNS)
+	fmt.Fprintf(writer, "  Timeout:\t%v\n", meta.TimeoutNS)
+	fmt.Fprintf(writer, "  Concurrency:\t%d (peak in flight %d)\n", meta.Concurrency, receiver.PeakInFlight)
+	fmt.Fprintf(writer, "Rate\n")
+	fmt.Fprintf(writer, "  Offered:\t%d payloads, %.2f pps\n", receiver.Offered, receiver.OfferedPPS)
+	fmt.Fprintf(writer, "  Achieved:\t%.2f pps\n", receiver.AchievedPPS)
+	fmt.Fprintf(writer, "Results\n")
+	fmt.Fprintf(writer, "  Calls:\t%d\n", receiver.Calls)
+	for _, code := range receiver.Codes {
+		fmt.Fprintf(writer, "  %s (%d):\t%d\n", code.Label, code.Code, code.Count)
+	}
+	fmt.Fprintf(writer, "  Dropped:\t%d\n", receiver.Dropped)
+	fmt.Fprintf(writer, "  Ignored:\t%d\n", receiver.Ignored)
+	if receiver.Spilled > 0 {
+		fmt.Fprintf(writer, "  Spilled:\t%d\n", receiver.Spilled)
+	}
+	fmt.Fprintf(writer, "  Abandoned:\t%d\n", receiver.Abandoned)
+	fmt.Fprintf(writer, "  Cancelled:\t%d (late %d)\n", receiver.Cancelled, receiver.Late)
+	fmt.Fprintf(writer, "Latency\n")
+	printLatency(writer, "All", receiver.Latency)
+	printLatency(writer, "Success", receiver.SuccessLatency)
+	if len(receiver.TimeSeries) > 0 {
+		fmt.Fprintf(writer, "Time series\n")
+		for _, window := range receiver.TimeSeries {
+			fmt.Fprintf(writer, "  +%v:\tsent %d\tcompleted %d\tfailed %d\tp50 %v\tp99 %v\n", window.Start.Sub(meta.StartedAt).Round(time.Millisecond), window.Sent, window.Completed, window.Failed, window.Latency.P50, window.Latency.P99)
+		}
+	}
+	writer.Flush()
+	return buffer.String()
+}
+
+func printLatency(writer *tabwriter.Writer, name string, latency lib.LatencySummary) {
+	fmt.Fprintf(writer, "  %s:\tcount %d\tmin %v\tmean %v\tstddev %v\tmax %v\n", name, latency.Count, latency.Min, latency.Mean, latency.StdDev, latency.Max)
+	fmt.Fprintf(writer, "  \tp50 %v\tp90 %v\tp99 %v\tp99.9 %v\tp99.99 %v\tp99.999 %v\n", latency.P50, latency.P90, latency.P99, latency.P999, latency.P9999, latency.P99999)
+}
+
+// runMode names the load model of the generator.
+func (receiver *loadGenerator) runMode() string {
+	switch {
+	case receiver.virtualUsers > 0:
+		return "closed-loop"
+	case receiver.trace != nil:
+		return "replay"
+	default:
+		return "open-loop"
+	}
+}
+
+// Report summarizes the last run, or the run so far while it is going on.
+func (receiver *loadGenerator) Report() *Report {
+	receiver.runLock.Lock()
+	meta := RunMetadata{StartedAt: receiver.startedAt, EndedAt: receiver.endedAt, DurationNS: receiver.ranFor}
+	receiver.runLock.Unlock()
+	if meta.EndedAt.IsZero() && !meta.StartedAt.IsZero() {
+		meta.DurationNS = receiver.clock.elapsed()
+	}
+	profile, _ := receiver.currentProfile()
+	meta.Mode = receiver.runMode()
+	meta.Arrival = receiver.arrivalName
+	meta.PPS = atomic.LoadUint64(&receiver.pps)
+	meta.Stages = len(profile.stages)
+	meta.Spikes = len(profile.spikes)
+	meta.VirtualUsers = receiver.virtualUsers
+	meta.TimeoutNS = receiver.timeout()
+	meta.ProcessingDurationNS = receiver.processingDurationNS
+	meta.TotalRequests = receiver.totalRequests
+	meta.WarmUpDurationNS = receiver.warmUpDurationNS
+	meta.Concurrency = atomic.LoadUint64(&receiver.concurrency)
+	meta.Backpressure = receiver.backpressure
+	meta.Delivery = receiver.delivery
+
+	report := &Report{
+		Metadata:       meta,
+		Calls:          receiver.CallCount(),
+		Latency:        receiver.aggregator.All(),
+		SuccessLatency: receiver.aggregator.Success(),
+		PeakInFlight:   receiver.PeakInFlight(),
+		Ignored:        atomic.LoadUint64(&receiver.ignoredCount),
+		Abandoned:      receiver.AbandonedCount(),
+		Cancelled:      receiver.CancelledCount(),
+		Late:           receiver.LateCount(),
+		Backpressure:   receiver.BackpressureStats(),
+		Scheduler:      receiver.SchedulerStats(),
+		TimeSeries:     receiver.TimeSeries(),
+	}
+	report.Dropped = report.Backpressure.Dropped
+	if receiver.spill != nil {
+		report.Spilled = receiver.spill.Spilled()
+		report.Ignored += receiver.spill.Failures()
+	}
+	report.Offered = atomic.LoadUint64(&receiver.issuedCount) + report.Dropped
+	if receiver.totalRequests > 0 && report.Offered > receiver.totalRequests+report.Dropped {
+		// Claims beyond totalRequests were turned down, not offered.
+		report.Offered = receiver.totalRequests + report.Dropped
+	}
+	for _, code := range receiver.aggregator.Codes() {
+		latency := receiver.aggregator.ByCode(code)
+		report.Codes = append(report.Codes, CodeCount{Code: code, Label: lib.GetRetCodePlain(code), Count: latency.Count, Latency: latency})
+	}
+	if meta.DurationNS > 0 {
+		report.OfferedPPS = float64(report.Offered) / meta.DurationNS.Seconds()
+	}
+	if measured := meta.DurationNS - meta.WarmUpDurationNS; measured > 0 {
+		report.AchievedPPS = float64(report.SuccessLatency.Count) / measured.Seconds()
+	}
+	return report
+}